@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"spdeploy/internal"
@@ -21,32 +25,113 @@ var (
 var rootCmd = &cobra.Command{
 	Use:   "spdeploy",
 	Short: "Simple SSH-based git repository deployment monitor",
-	Long: `SPDeploy monitors git repositories via SSH and automatically pulls changes.
-It uses SSH keys for authentication and runs as a simple process.`,
+	Long: `SPDeploy monitors git repositories over SSH, HTTPS or the local filesystem and
+automatically pulls changes. It uses SSH keys or access tokens for authentication
+and runs as a simple process.`,
 	Version: fmt.Sprintf("%s (commit: %s, built: %s)", Version, GitCommit, BuildDate),
 }
 
 var addCmd = &cobra.Command{
-	Use:   "add <ssh-url> <path>",
+	Use:   "add <url> <path>",
 	Short: "Add a repository to monitor",
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		sshURL := args[0]
 		localPath := args[1]
 		branch, _ := cmd.Flags().GetString("branch")
 		script, _ := cmd.Flags().GetString("script")
+		interpreter, _ := cmd.Flags().GetString("interpreter")
+		scriptTimeout, _ := cmd.Flags().GetInt("script-timeout")
+		scriptRetries, _ := cmd.Flags().GetInt("script-retries")
+		strategy, _ := cmd.Flags().GetString("strategy")
+		shared, _ := cmd.Flags().GetStringSlice("shared")
+		keepReleases, _ := cmd.Flags().GetInt("keep-releases")
+		tag, _ := cmd.Flags().GetString("tag")
+		prerelease, _ := cmd.Flags().GetBool("prerelease")
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+		gitTimeout, _ := cmd.Flags().GetInt("git-timeout")
+		gitBackend, _ := cmd.Flags().GetString("git-backend")
+		submodules, _ := cmd.Flags().GetString("submodules")
+		lfs, _ := cmd.Flags().GetBool("lfs")
+		depth, _ := cmd.Flags().GetInt("depth")
+		sparsePaths, _ := cmd.Flags().GetStringArray("sparse-path")
+		includePaths, _ := cmd.Flags().GetStringArray("include-path")
+		excludePaths, _ := cmd.Flags().GetStringArray("exclude-path")
+		tokenEnv, _ := cmd.Flags().GetString("token-env")
+		sshKey, _ := cmd.Flags().GetString("ssh-key")
+		knownHosts, _ := cmd.Flags().GetString("known-hosts")
+		strictHostKeyChecking, _ := cmd.Flags().GetString("strict-host-key-checking")
+		requireSigned, _ := cmd.Flags().GetString("require-signed")
+		allowedSigners, _ := cmd.Flags().GetString("allowed-signers")
+		gpgKeyring, _ := cmd.Flags().GetString("gpg-keyring")
+		hookFlags, _ := cmd.Flags().GetStringArray("hook")
+		directiveFlags, _ := cmd.Flags().GetStringArray("directive")
+		interval, _ := cmd.Flags().GetInt("interval")
+		schedule, _ := cmd.Flags().GetString("schedule")
+		jitter, _ := cmd.Flags().GetInt("jitter")
+
+		// Validate the URL; local paths are made absolute
+		repoURL, err := internal.NormalizeRemoteURL(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
-		// Validate SSH URL
-		if !strings.HasPrefix(sshURL, "git@") {
-			fmt.Fprintf(os.Stderr, "Error: Only SSH URLs are supported (must start with git@)\n")
+		if strategy != internal.StrategyPull && strategy != internal.StrategyRelease {
+			fmt.Fprintf(os.Stderr, "Error: Unknown strategy %q (use %q or %q)\n", strategy, internal.StrategyPull, internal.StrategyRelease)
 			os.Exit(1)
 		}
 
+		var hooks *internal.Hooks
+		for _, h := range hookFlags {
+			stage, command, ok := strings.Cut(h, "=")
+			if !ok || strings.TrimSpace(command) == "" {
+				fmt.Fprintf(os.Stderr, "Error: Invalid hook %q (use stage=command)\n", h)
+				os.Exit(1)
+			}
+			if hooks == nil {
+				hooks = &internal.Hooks{}
+			}
+			if err := hooks.Add(stage, command); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v (stages: %s)\n", err, strings.Join(internal.HookStages, ", "))
+				os.Exit(1)
+			}
+		}
+
+		var directives *internal.Directives
+		for _, d := range directiveFlags {
+			kind, token, ok := strings.Cut(d, "=")
+			if !ok || strings.TrimSpace(token) == "" {
+				fmt.Fprintf(os.Stderr, "Error: Invalid directive %q (use kind=token)\n", d)
+				os.Exit(1)
+			}
+			if directives == nil {
+				directives = &internal.Directives{}
+			}
+			if err := directives.Add(kind, token); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v (kinds: %s)\n", err, strings.Join(internal.DirectiveKinds, ", "))
+				os.Exit(1)
+			}
+		}
+
+		// Stored absolute, since the daemon may run from another directory
+		if sshKey != "" {
+			sshKey, _ = filepath.Abs(sshKey)
+		}
+		if knownHosts != "" {
+			knownHosts, _ = filepath.Abs(knownHosts)
+		}
+		if allowedSigners != "" {
+			allowedSigners, _ = filepath.Abs(allowedSigners)
+		}
+		if gpgKeyring != "" {
+			gpgKeyring, _ = filepath.Abs(gpgKeyring)
+		}
+
 		cfg := internal.LoadConfig()
 
 		// Check if repository already exists
 		for _, repo := range cfg.Repositories {
-			if repo.URL == sshURL && repo.Path == localPath {
+			if repo.URL == repoURL && repo.Path == localPath {
 				fmt.Fprintf(os.Stderr, "Error: Repository already exists\n")
 				os.Exit(1)
 			}
@@ -54,10 +139,89 @@ var addCmd = &cobra.Command{
 
 		// Add repository
 		repo := internal.Repository{
-			URL:            sshURL,
-			Branch:         branch,
-			Path:           localPath,
-			PostPullScript: script,
+			URL:                   repoURL,
+			Branch:                branch,
+			Path:                  localPath,
+			PostPullScript:        script,
+			Tag:                   tag,
+			Prerelease:            prerelease,
+			OnConflict:            onConflict,
+			GitTimeout:            gitTimeout,
+			GitBackend:            gitBackend,
+			Submodules:            submodules,
+			LFS:                   lfs,
+			Depth:                 depth,
+			SparsePaths:           sparsePaths,
+			IncludePaths:          includePaths,
+			ExcludePaths:          excludePaths,
+			Directives:            directives,
+			TokenEnv:              tokenEnv,
+			SSHKey:                sshKey,
+			KnownHosts:            knownHosts,
+			StrictHostKeyChecking: strictHostKeyChecking,
+			RequireSigned:         requireSigned,
+			AllowedSigners:        allowedSigners,
+			GPGKeyring:            gpgKeyring,
+			ScriptInterpreter:     interpreter,
+			ScriptTimeout:         scriptTimeout,
+			ScriptRetries:         scriptRetries,
+			Hooks:                 hooks,
+			Interval:              interval,
+			Schedule:              schedule,
+			Jitter:                jitter,
+		}
+		if err := internal.CheckSSHIdentity(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if prerelease && tag == "" {
+			fmt.Fprintf(os.Stderr, "Error: --prerelease requires --tag\n")
+			os.Exit(1)
+		}
+		if err := internal.ValidateScriptInterpreter(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := internal.ValidateCheckoutExtras(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := internal.ValidateSignedPolicy(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := internal.ValidateConflictPolicy(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := internal.ValidateTagPattern(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := internal.ValidateSchedule(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if interval != 0 && interval < 10 {
+			fmt.Fprintf(os.Stderr, "Error: Interval must be at least 10 seconds\n")
+			os.Exit(1)
+		}
+		if strategy == internal.StrategyRelease {
+			repo.Strategy = strategy
+			repo.SharedPaths = shared
+			repo.KeepReleases = keepReleases
+		}
+		if err := internal.ValidateGitBackend(repo, cfg.GitBackend); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := internal.ValidateWatchPaths(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := internal.ValidateDepthAndSparse(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
 
 		// Validate repository can be accessed
@@ -73,23 +237,29 @@ var addCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		fmt.Printf("✓ Added repository: %s → %s (branch: %s)\n", sshURL, localPath, branch)
+		if tag != "" {
+			fmt.Printf("✓ Added repository: %s → %s (tags: %s)\n", repoURL, localPath, tag)
+		} else {
+			fmt.Printf("✓ Added repository: %s → %s (branch: %s)\n", repoURL, localPath, branch)
+		}
 	},
 }
 
 var removeCmd = &cobra.Command{
-	Use:   "remove <ssh-url>",
+	Use:   "remove <url>",
 	Short: "Remove a repository from monitoring",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		sshURL := args[0]
+		repoURL := args[0]
+		// Local paths are stored as absolute paths
+		normalized, _ := internal.NormalizeRemoteURL(repoURL)
 
 		cfg := internal.LoadConfig()
 
 		found := false
 		newRepos := []internal.Repository{}
 		for _, repo := range cfg.Repositories {
-			if repo.URL == sshURL {
+			if repo.URL == repoURL || repo.URL == normalized {
 				found = true
 				continue
 			}
@@ -108,7 +278,7 @@ var removeCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		fmt.Printf("✓ Removed repository: %s\n", sshURL)
+		fmt.Printf("✓ Removed repository: %s\n", repoURL)
 	},
 }
 
@@ -126,12 +296,192 @@ var listCmd = &cobra.Command{
 		fmt.Printf("Monitored repositories (check every %d seconds):\n", cfg.CheckInterval)
 		for i, repo := range cfg.Repositories {
 			fmt.Printf("%d. %s\n", i+1, repo.URL)
-			fmt.Printf("   Branch: %s\n", repo.Branch)
+			if repo.Tag != "" {
+				prerelease := ""
+				if repo.Prerelease {
+					prerelease = " (including pre-releases)"
+				}
+				fmt.Printf("   Tags: %s%s\n", repo.Tag, prerelease)
+			} else {
+				fmt.Printf("   Branch: %s\n", repo.Branch)
+			}
 			fmt.Printf("   Path: %s\n", repo.Path)
+			fmt.Printf("   Schedule: %s\n", internal.DescribeSchedule(cfg, repo))
+			if repo.SSHKey != "" {
+				fmt.Printf("   SSH key: %s\n", repo.SSHKey)
+			}
+			if repo.RequireSigned != "" {
+				fmt.Printf("   Require signed: %s\n", repo.RequireSigned)
+			}
 			if repo.PostPullScript != "" {
 				fmt.Printf("   Script: %s\n", repo.PostPullScript)
+				if repo.ScriptInterpreter != "" {
+					fmt.Printf("   Interpreter: %s\n", repo.ScriptInterpreter)
+				}
+				if repo.ScriptTimeout > 0 {
+					fmt.Printf("   Script timeout: %ds\n", repo.ScriptTimeout)
+				}
+			}
+			if repo.GitTimeout > 0 {
+				fmt.Printf("   Git timeout: %ds\n", repo.GitTimeout)
+			}
+			if repo.GitBackend != "" {
+				fmt.Printf("   Git backend: %s\n", repo.GitBackend)
+			}
+			if mirror := internal.MirrorPath(repo); mirror != "" {
+				fmt.Printf("   Mirror: %s\n", mirror)
+			}
+			if repo.OnConflict != "" {
+				fmt.Printf("   On conflict: %s\n", repo.OnConflict)
+			}
+			if repo.Submodules != "" {
+				fmt.Printf("   Submodules: %s\n", repo.Submodules)
+			}
+			if repo.LFS {
+				fmt.Printf("   LFS: enabled\n")
+			}
+			if repo.Depth > 0 {
+				fmt.Printf("   Depth: %d\n", repo.Depth)
+			}
+			if len(repo.SparsePaths) > 0 {
+				fmt.Printf("   Sparse paths: %s\n", strings.Join(repo.SparsePaths, ", "))
+			}
+			if len(repo.IncludePaths) > 0 {
+				fmt.Printf("   Include paths: %s\n", strings.Join(repo.IncludePaths, ", "))
+			}
+			if len(repo.ExcludePaths) > 0 {
+				fmt.Printf("   Exclude paths: %s\n", strings.Join(repo.ExcludePaths, ", "))
 			}
+			if repo.Directives != nil {
+				for _, kind := range internal.DirectiveKinds {
+					fmt.Printf("   Directive %s: %s\n", kind, strings.Join(repo.Directives.Tokens(kind), ", "))
+				}
+			}
+			if repo.Strategy == internal.StrategyRelease {
+				fmt.Printf("   Strategy: release (current: %s/current)\n", repo.Path)
+				if len(repo.SharedPaths) > 0 {
+					fmt.Printf("   Shared: %s\n", strings.Join(repo.SharedPaths, ", "))
+				}
+			}
+			for _, stage := range internal.HookStages {
+				for _, command := range repo.Hooks.Commands(stage) {
+					fmt.Printf("   Hook %s: %s\n", stage, command)
+				}
+			}
+			if state := internal.GetRepoState(repo); state.PinnedSHA != "" {
+				pinned := state.PinnedSHA
+				if state.PinnedAt != nil {
+					pinned += fmt.Sprintf(" (since %s)", state.PinnedAt.Format("2006-01-02 15:04"))
+				}
+				fmt.Printf("   Pinned: %s\n", pinned)
+			}
+		}
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <repo>",
+	Short: "Roll a repository back to a previously deployed commit",
+	Long: `Roll a repository back to a previously deployed commit and re-run its post-pull script.
+<repo> is the repository URL or deploy path. --to takes a commit SHA or the number of
+deployments to go back (default 1). The repository stays pinned on that commit until
+'spdeploy unpin' is run.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+
+		cfg := internal.LoadConfig()
+		repo, err := internal.FindRepository(cfg, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		sha, err := internal.NewMonitorV2(cfg).Rollback(*repo, to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Rollback failed: %v\n", err)
+			os.Exit(1)
 		}
+
+		fmt.Printf("✓ Rolled back %s to %s\n", repo.Path, sha)
+		fmt.Println("  Updates are paused until: spdeploy unpin " + args[0])
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin <repo>",
+	Short: "Resume updates for a repository pinned by rollback",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := internal.LoadConfig()
+		repo, err := internal.FindRepository(cfg, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := internal.Unpin(*repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to unpin repository: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("✓ Unpinned %s, updates resume on the next check\n", repo.Path)
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show deployment history",
+	Run: func(cmd *cobra.Command, args []string) {
+		repoFilter, _ := cmd.Flags().GetString("repo")
+		limit, _ := cmd.Flags().GetInt("limit")
+		output, _ := cmd.Flags().GetString("output")
+
+		deployments, err := internal.LoadHistory(internal.HistoryFilter{Repo: repoFilter, Limit: limit})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if deployments == nil {
+				deployments = []internal.Deployment{}
+			}
+			enc.Encode(deployments)
+			return
+		}
+
+		if len(deployments) == 0 {
+			fmt.Println("No deployments recorded")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STARTED\tPATH\tREF\tKIND\tCHANGE\tCOMMITS\tSCRIPT\tSTATUS\tDURATION")
+		for _, d := range deployments {
+			ref := d.Branch
+			if d.Tag != "" {
+				ref = d.Tag
+			}
+			script := "-"
+			if d.ScriptExitCode != nil {
+				script = fmt.Sprintf("exit %d", *d.ScriptExitCode)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s..%s\t%d\t%s\t%s\t%s\n",
+				d.StartedAt.Format("2006-01-02 15:04:05"),
+				d.Path,
+				ref,
+				d.Kind,
+				shortSHA(d.OldSHA),
+				shortSHA(d.NewSHA),
+				d.CommitCount,
+				script,
+				d.Status,
+				(time.Duration(d.DurationMS) * time.Millisecond).String())
+		}
+		w.Flush()
 	},
 }
 
@@ -141,6 +491,12 @@ var runCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		daemon, _ := cmd.Flags().GetBool("daemon")
 
+		// Refuse to start with a config a reload would reject, e.g. a webhook without a secret
+		if _, err := internal.ReadConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
 		if daemon {
 			// Check if daemon is already running
 			if internal.IsDaemonRunning() {
@@ -196,16 +552,32 @@ var runCmd = &cobra.Command{
 
 		go func() {
 			<-sigChan
-			fmt.Println("\n✓ Shutting down...")
-			// Clean up PID file if running as foreground daemon
-			internal.CleanupDaemonPID()
-			os.Exit(0)
+			fmt.Println("\n✓ Shutting down, waiting for running deploys (press Ctrl+C again to force)...")
+			go func() {
+				<-sigChan
+				internal.CleanupDaemonPID()
+				os.Exit(1)
+			}()
+			monitor.Shutdown()
+		}()
+
+		// SIGHUP reloads the config; edits to config.json are also picked up automatically
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		go func() {
+			for range hupChan {
+				monitor.ReloadConfig()
+			}
 		}()
 
 		fmt.Printf("Starting monitor for %d repositories (interval: %d seconds)\n",
 			len(cfg.Repositories), cfg.CheckInterval)
 
+		// Run returns once a signal has triggered a graceful shutdown
 		monitor.Run()
+
+		// Clean up PID file if running as foreground daemon
+		internal.CleanupDaemonPID()
 	},
 }
 
@@ -223,6 +595,13 @@ var stopCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		fmt.Println("Waiting for running deploys to finish...")
+		// Allow for scripts being killed after the grace period
+		if !internal.WaitForDaemonExit(internal.LoadConfig().ShutdownGracePeriod() + 15*time.Second) {
+			fmt.Fprintf(os.Stderr, "Error: Daemon is still running\n")
+			os.Exit(1)
+		}
+
 		fmt.Println("✓ Daemon stopped successfully")
 	},
 }
@@ -244,6 +623,14 @@ var statusCmd = &cobra.Command{
 			fmt.Println("✗ SPDeploy daemon is not running")
 			fmt.Println("  To start: spdeploy run -d")
 		}
+
+		cfg := internal.LoadConfig()
+		printInterrupted(cfg)
+		printConflicts(cfg)
+		printUnverified(cfg)
+		printTimeouts(cfg)
+		printFailures(cfg)
+		printScriptRetries(cfg)
 	},
 }
 
@@ -272,7 +659,42 @@ By default, shows logs for the current repository if in a git directory.`,
 
 func init() {
 	addCmd.Flags().String("branch", "main", "Branch to monitor")
+	addCmd.Flags().String("tag", "", "Deploy the highest semver tag matching this pattern, e.g. 'v*', instead of the branch head")
+	addCmd.Flags().Bool("prerelease", false, "Also deploy pre-release tags such as v2.0.0-rc.1 (with --tag)")
+	addCmd.Flags().String("on-conflict", "", "When local changes or diverged history block an update: fail (default), stash or reset")
+	addCmd.Flags().Int("git-timeout", 0, "Kill git commands for this repository after this many seconds (default: the global git_timeout, 300)")
+	addCmd.Flags().String("git-backend", "", "Git implementation: exec (the git binary) or go-git (built in, pull strategy and branches only)")
+	addCmd.Flags().String("submodules", "", "Check out submodules after every clone and update: recursive")
+	addCmd.Flags().Bool("lfs", false, "Download Git LFS files after every clone and update (needs git-lfs)")
+	addCmd.Flags().Int("depth", 0, "Clone and fetch only this many commits of history (default: full history)")
+	addCmd.Flags().StringArray("sparse-path", nil, "Only check out this directory, plus files at the root (repeatable)")
+	addCmd.Flags().StringArray("include-path", nil, "Only deploy when a changed file matches this glob, e.g. 'api/**' (repeatable)")
+	addCmd.Flags().StringArray("exclude-path", nil, "Don't deploy for changes to files matching this glob, e.g. 'docs/' (repeatable)")
+	addCmd.Flags().String("token-env", "", "Environment variable holding the token for an HTTPS URL")
+	addCmd.Flags().String("ssh-key", "", "Private key for an SSH URL, e.g. a deploy key (default: the user's SSH setup)")
+	addCmd.Flags().String("known-hosts", "", "known_hosts file to verify the SSH host key against")
+	addCmd.Flags().String("strict-host-key-checking", "", "SSH host key checking: yes, no or accept-new")
+	addCmd.Flags().String("require-signed", "", "Refuse commits without a valid signature: tip (the deployed commit) or all (every incoming commit)")
+	addCmd.Flags().String("allowed-signers", "", "SSH allowed signers file to verify commit signatures against (with --require-signed)")
+	addCmd.Flags().String("gpg-keyring", "", "GPG public keys to verify commit signatures against (with --require-signed)")
 	addCmd.Flags().String("script", "", "Post-pull script to execute")
+	addCmd.Flags().String("interpreter", "", "Interpreter for the post-pull script (default: the script's shebang, then /bin/sh)")
+	addCmd.Flags().Int("script-timeout", 0, "Kill the post-pull script after this many seconds (0 for no limit)")
+	addCmd.Flags().Int("script-retries", 0, "Times to retry a failed post-pull script for the same commit (0 for the default of 5, -1 to never retry)")
+	addCmd.Flags().String("strategy", internal.StrategyPull, "Deploy strategy: pull (update in place) or release (atomic release directories)")
+	addCmd.Flags().StringSlice("shared", nil, "Path shared across releases, e.g. uploads/ or .env (repeatable, release strategy only)")
+	addCmd.Flags().Int("keep-releases", 5, "Number of releases to keep (release strategy only)")
+	addCmd.Flags().Int("interval", 0, "Check interval in seconds for this repository (default: the global check_interval)")
+	addCmd.Flags().String("schedule", "", "Cron expression for checks instead of an interval, e.g. \"0 * * * *\" or @hourly")
+	addCmd.Flags().Int("jitter", 0, "Random delay of up to this many seconds added to each check")
+	addCmd.Flags().StringArray("hook", nil, "Deploy hook as stage=command, e.g. pre_deploy='make test' (repeatable)")
+	addCmd.Flags().StringArray("directive", nil, "Commit message token as kind=token, e.g. skip='[nodeploy]'; replaces that kind's defaults (repeatable)")
+
+	rollbackCmd.Flags().String("to", "", "Commit SHA or number of deployments to go back (default 1)")
+
+	historyCmd.Flags().StringP("repo", "r", "", "Only show deployments for this repository URL or path")
+	historyCmd.Flags().IntP("limit", "n", 20, "Maximum number of deployments to show (0 for all)")
+	historyCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
 
 	runCmd.Flags().BoolP("daemon", "d", false, "Run in background")
 
@@ -285,12 +707,150 @@ func init() {
 	rootCmd.AddCommand(addCmd)
 	rootCmd.AddCommand(removeCmd)
 	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(rollbackCmd)
+	rootCmd.AddCommand(unpinCmd)
+	rootCmd.AddCommand(historyCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(stopCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(logCmd)
 }
 
+// printInterrupted reports deployments cut short by a daemon shutdown
+func printInterrupted(cfg *internal.Config) {
+	header := false
+	for _, repo := range cfg.Repositories {
+		state := internal.GetRepoState(repo)
+		marker := state.Interrupted
+		if marker == nil {
+			// Left behind by a daemon that was killed without shutting down
+			if marker = state.InProgress; marker == nil || internal.IsDaemonRunning() {
+				continue
+			}
+		}
+		if !header {
+			fmt.Println("\nInterrupted deployments:")
+			header = true
+		}
+		fmt.Printf("  %s (%s → %s): started %s\n",
+			repo.Path, shortSHA(marker.OldSHA), shortSHA(marker.NewSHA), marker.StartedAt.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// printConflicts reports repositories whose update is blocked by local changes or diverged history
+func printConflicts(cfg *internal.Config) {
+	header := false
+	for _, repo := range cfg.Repositories {
+		conflict := internal.GetRepoState(repo).Conflict
+		if conflict == nil {
+			continue
+		}
+		if !header {
+			fmt.Println("\nBlocked updates:")
+			header = true
+		}
+		fmt.Printf("  %s (→ %s): %s, since %s\n",
+			repo.Path, shortSHA(conflict.SHA), conflict.Reason, conflict.Since.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// printUnverified reports repositories whose update was refused by require_signed
+func printUnverified(cfg *internal.Config) {
+	header := false
+	for _, repo := range cfg.Repositories {
+		unverified := internal.GetRepoState(repo).Unverified
+		if unverified == nil {
+			continue
+		}
+		if !header {
+			fmt.Println("\nRefused updates (unverified signatures):")
+			header = true
+		}
+		fmt.Printf("  %s (→ %s): %s, since %s\n",
+			repo.Path, shortSHA(unverified.SHA), unverified.Reason, unverified.Since.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// printTimeouts reports repositories whose last git command was killed for running too long
+func printTimeouts(cfg *internal.Config) {
+	header := false
+	for _, repo := range cfg.Repositories {
+		timeout := internal.GetRepoState(repo).Timeout
+		if timeout == nil {
+			continue
+		}
+		if !header {
+			fmt.Println("\nTimed out:")
+			header = true
+		}
+		fmt.Printf("  %s: git %s timed out at %s\n", repo.Path, timeout.Command, timeout.At.Format("2006-01-02 15:04:05"))
+		fmt.Printf("    Error: %s\n", timeout.Error)
+	}
+}
+
+// printFailures reports repositories whose checks keep failing, and whether their circuit is open
+func printFailures(cfg *internal.Config) {
+	header := false
+	for _, repo := range cfg.Repositories {
+		failures := internal.GetRepoState(repo).Failures
+		if failures == nil {
+			continue
+		}
+		if !header {
+			fmt.Println("\nFailing repositories:")
+			header = true
+		}
+		circuit := "closed"
+		if failures.CircuitOpen {
+			circuit = "open since " + failures.OpenedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  %s: %d consecutive failures since %s (circuit %s)\n",
+			repo.Path, failures.Streak, failures.Since.Format("2006-01-02 15:04:05"), circuit)
+		fmt.Printf("    Next check: %s\n", failures.NextCheck.Format("2006-01-02 15:04:05"))
+		fmt.Printf("    Last error: %s\n", failures.LastError)
+	}
+}
+
+// printScriptRetries reports repositories whose post-pull script failed after deploying
+func printScriptRetries(cfg *internal.Config) {
+	header := false
+	for _, repo := range cfg.Repositories {
+		retry := internal.GetRepoState(repo).ScriptRetry
+		if retry == nil {
+			continue
+		}
+		if !header {
+			fmt.Println("\nPost-pull script retries:")
+			header = true
+		}
+
+		switch retry.Status {
+		case internal.ScriptRetryPending:
+			fmt.Printf("  %s (%s): pending, %d failed attempt(s), next retry %s\n",
+				repo.Path, shortSHA(retry.SHA), retry.Attempts, retry.NextAttempt.Format("2006-01-02 15:04:05"))
+		case internal.ScriptRetryAbandoned:
+			fmt.Printf("  %s (%s): gave up after %d attempts\n", repo.Path, shortSHA(retry.SHA), retry.Attempts)
+		case internal.ScriptRetrySucceeded:
+			fmt.Printf("  %s (%s): succeeded after %d attempts at %s\n",
+				repo.Path, shortSHA(retry.SHA), retry.Attempts, retry.LastAttempt.Format("2006-01-02 15:04:05"))
+		}
+		if retry.LastError != "" {
+			fmt.Printf("    Last error: %s\n", retry.LastError)
+		}
+	}
+}
+
+// shortSHA abbreviates a commit hash for table output
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	if sha == "" {
+		return "-"
+	}
+	return sha
+}
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -32,6 +32,9 @@ func TestCommands(t *testing.T) {
 		"add",
 		"remove",
 		"list",
+		"rollback",
+		"unpin",
+		"history",
 		"run",
 		"stop",
 		"log",
@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Git backends
+const (
+	// GitBackendExec runs the git binary (default)
+	GitBackendExec = "exec"
+	// GitBackendGoGit uses the go-git library, so git needn't be installed
+	GitBackendGoGit = "go-git"
+)
+
+// GitBackend is the set of git operations the monitor needs to keep a
+// branch checkout up to date. Operations that talk to the remote take the
+// repository for its credentials, SSH settings and timeout.
+type GitBackend interface {
+	// Clone clones repo.URL into repo.Path
+	Clone(repo Repository) error
+	// RemoteURL returns the URL of dir's origin remote
+	RemoteURL(dir string) (string, error)
+	// RemoteChanged reports whether origin's refs for repo differ from dir's copies
+	RemoteChanged(repo Repository, dir string) (bool, error)
+	// Fetch updates dir's copies of origin's refs for repo
+	Fetch(repo Repository, dir string) error
+	// CurrentBranch returns the branch checked out in dir, or "" when HEAD is detached
+	CurrentBranch(dir string) (string, error)
+	// Checkout switches dir to branch, creating it from origin's if needed
+	Checkout(dir, branch string) error
+	// Resolve returns the commit rev points at, e.g. HEAD or origin/main
+	Resolve(dir, rev string) (string, error)
+	// AheadCount returns how many commits rev has that base doesn't
+	AheadCount(dir, base, rev string) (int, error)
+	// CommitMessages returns the messages of the commits rev has that base doesn't
+	CommitMessages(dir, base, rev string) ([]string, error)
+	// HasLocalChanges reports whether tracked files in dir were modified
+	HasLocalChanges(dir string) (bool, error)
+	// ChangedFiles lists the paths that differ between the commits from and to
+	ChangedFiles(dir, from, to string) ([]string, error)
+	// FastForward moves dir's current branch and working tree to target,
+	// failing if that isn't a fast-forward, and returns a summary
+	FastForward(dir, target string) (string, error)
+}
+
+// globalGitBackend is the config's git_backend, updated with globalGitTimeout
+var globalGitBackend atomic.Value
+
+// setGitDefaults applies config's git_timeout, git_backend and
+// shared_mirrors to subsequent git operations
+func setGitDefaults(config *Config) {
+	globalGitTimeout.Store(int64(config.GitTimeout))
+	globalGitBackend.Store(config.GitBackend)
+	globalSharedMirrors.Store(config.SharedMirrors)
+}
+
+// gitBackendName returns the backend repo uses: its own git_backend, then
+// global, then exec
+func gitBackendName(repo Repository, global string) string {
+	if repo.GitBackend != "" {
+		return repo.GitBackend
+	}
+	if global != "" {
+		return global
+	}
+	return GitBackendExec
+}
+
+// backendFor returns the git backend for repo
+func backendFor(repo Repository) GitBackend {
+	global, _ := globalGitBackend.Load().(string)
+	if gitBackendName(repo, global) == GitBackendGoGit {
+		return goGitBackend{}
+	}
+	return execBackend{}
+}
+
+// usesExec reports whether repo runs the git binary
+func usesExec(repo Repository) bool {
+	global, _ := globalGitBackend.Load().(string)
+	return gitBackendName(repo, global) == GitBackendExec
+}
+
+// ValidateGitBackend checks the git backend repo would use given the
+// config's global git_backend. The go-git backend only covers branch
+// tracking with the pull strategy; tags, releases and the stash and reset
+// conflict policies still need the git binary.
+func ValidateGitBackend(repo Repository, global string) error {
+	switch name := gitBackendName(repo, global); name {
+	case GitBackendExec:
+		return nil
+	case GitBackendGoGit:
+	default:
+		return fmt.Errorf("unknown git backend %q (use %s or %s)", name, GitBackendExec, GitBackendGoGit)
+	}
+
+	switch {
+	case repo.Strategy == StrategyRelease:
+		return fmt.Errorf("the %s backend does not support the release strategy", GitBackendGoGit)
+	case repo.Tag != "":
+		return fmt.Errorf("the %s backend does not support tag tracking", GitBackendGoGit)
+	case repo.OnConflict == ConflictStash || repo.OnConflict == ConflictReset:
+		return fmt.Errorf("the %s backend does not support on_conflict %s", GitBackendGoGit, repo.OnConflict)
+	case repo.Depth > 0 || len(repo.SparsePaths) > 0:
+		return fmt.Errorf("the %s backend does not support depth or sparse_paths", GitBackendGoGit)
+	case repo.Submodules != "" || repo.LFS:
+		return fmt.Errorf("the %s backend does not support submodules or lfs", GitBackendGoGit)
+	case repo.RequireSigned != "":
+		return fmt.Errorf("the %s backend does not support require_signed", GitBackendGoGit)
+	}
+	return nil
+}
+
+// execBackend runs the git binary
+type execBackend struct{}
+
+func (execBackend) Clone(repo Repository) error {
+	// Tag-tracking repositories are checked out at their tag on the first check
+	args := []string{"clone", "-b", repo.Branch, repo.URL, repo.Path}
+	if repo.Tag != "" {
+		args = []string{"clone", repo.URL, repo.Path}
+	}
+	args = withArgs(args, depthArgs(repo)...)
+	if len(repo.SparsePaths) > 0 {
+		args = withArgs(args, "--sparse")
+	}
+	cmd, err := remoteGitCommand(repo, "", args...)
+	if err != nil {
+		return err
+	}
+	defer cmd.release()
+	output, err := cmd.CombinedOutput()
+	if err := cmd.wrap(err); err != nil {
+		return fmt.Errorf("%w\nOutput: %s", err, redactCredentials(string(output)))
+	}
+	return nil
+}
+
+func (execBackend) RemoteURL(dir string) (string, error) {
+	return runGit(dir, "remote", "get-url", "origin")
+}
+
+// RemoteChanged compares the branch head, or in tag mode the full set of
+// tags, using a single ls-remote round trip
+func (execBackend) RemoteChanged(repo Repository, dir string) (bool, error) {
+	if repo.Tag != "" {
+		output, err := runRemoteGit(repo, dir, "ls-remote", "--tags", "--refs", "origin")
+		if err != nil {
+			return false, err
+		}
+		local, err := runGit(dir, "for-each-ref", "--format=%(objectname) %(refname)", "refs/tags")
+		if err != nil {
+			return false, err
+		}
+		return !maps.Equal(parseRefs(output), parseRefs(local)), nil
+	}
+
+	ref := "refs/heads/" + repo.Branch
+	output, err := runRemoteGit(repo, dir, "ls-remote", "origin", ref)
+	if err != nil {
+		return false, err
+	}
+	sha, ok := parseRefs(output)[ref]
+	if !ok {
+		return false, fmt.Errorf("branch %s not found on origin", repo.Branch)
+	}
+	local, err := runGit(dir, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+repo.Branch)
+	return err != nil || local != sha, nil
+}
+
+func (execBackend) Fetch(repo Repository, dir string) error {
+	_, err := runRemoteGit(repo, dir, withArgs(fetchArgs(repo), depthArgs(repo)...)...)
+	return err
+}
+
+func (execBackend) CurrentBranch(dir string) (string, error) {
+	return runGit(dir, "branch", "--show-current")
+}
+
+func (execBackend) Checkout(dir, branch string) error {
+	_, err := runGit(dir, "checkout", branch)
+	return err
+}
+
+func (execBackend) Resolve(dir, rev string) (string, error) {
+	return runGit(dir, "rev-parse", "--verify", rev+"^{commit}")
+}
+
+func (execBackend) AheadCount(dir, base, rev string) (int, error) {
+	output, err := runGit(dir, "rev-list", "--count", base+".."+rev)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(output)
+}
+
+func (execBackend) CommitMessages(dir, base, rev string) ([]string, error) {
+	output, err := runGit(dir, "log", "--format=%B%x00", base+".."+rev)
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	for _, message := range strings.Split(output, "\x00") {
+		if message = strings.TrimSpace(message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (execBackend) HasLocalChanges(dir string) (bool, error) {
+	status, err := runGit(dir, "status", "--porcelain", "--untracked-files=no")
+	return status != "", err
+}
+
+func (execBackend) ChangedFiles(dir, from, to string) ([]string, error) {
+	output, err := runGit(dir, "diff", "--name-only", "--no-renames", "-z", from, to)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range strings.Split(output, "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (execBackend) FastForward(dir, target string) (string, error) {
+	return runGit(dir, "merge", "--ff-only", target)
+}
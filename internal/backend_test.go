@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitBackends(t *testing.T) {
+	for _, name := range []string{GitBackendExec, GitBackendGoGit} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+
+			origin := newTestOrigin(t)
+			gitT(t, origin, "checkout", "-q", "-b", "staging")
+			commitFile(t, origin, "staging.txt", "staging")
+			gitT(t, origin, "checkout", "-q", "main")
+
+			repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app"), GitBackend: name}
+			backend := backendFor(repo)
+			if err := ValidateRepository(repo); err != nil {
+				t.Fatalf("ValidateRepository failed: %v", err)
+			}
+			if url, err := backend.RemoteURL(repo.Path); err != nil || url != origin {
+				t.Errorf("RemoteURL = %q, %v, want %q", url, err, origin)
+			}
+			if branch, err := backend.CurrentBranch(repo.Path); err != nil || branch != "main" {
+				t.Errorf("CurrentBranch = %q, %v, want main", branch, err)
+			}
+
+			old := gitT(t, origin, "rev-parse", "HEAD")
+			commitFile(t, origin, "index.html", "v2")
+			head := commitFile(t, origin, "index.html", "v3")
+			if changed, err := backend.RemoteChanged(repo, repo.Path); err != nil || !changed {
+				t.Fatalf("RemoteChanged = %v, %v, want true", changed, err)
+			}
+			if err := backend.Fetch(repo, repo.Path); err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if sha, err := backend.Resolve(repo.Path, "origin/main"); err != nil || sha != head {
+				t.Errorf("Resolve(origin/main) = %q, %v, want %s", sha, err, head)
+			}
+			if n, err := backend.AheadCount(repo.Path, "HEAD", "origin/main"); err != nil || n != 2 {
+				t.Errorf("AheadCount = %d, %v, want 2", n, err)
+			}
+
+			// A local edit blocks the update
+			index := filepath.Join(repo.Path, "index.html")
+			os.WriteFile(index, []byte("edited"), 0644)
+			if dirty, err := backend.HasLocalChanges(repo.Path); err != nil || !dirty {
+				t.Errorf("HasLocalChanges = %v, %v, want true", dirty, err)
+			}
+			os.WriteFile(index, []byte("v1"), 0755)
+			os.WriteFile(filepath.Join(repo.Path, "untracked.txt"), []byte("x"), 0644)
+			if dirty, err := backend.HasLocalChanges(repo.Path); err != nil || dirty {
+				t.Errorf("HasLocalChanges = %v, %v, want untracked files ignored", dirty, err)
+			}
+
+			if _, err := backend.FastForward(repo.Path, "origin/main"); err != nil {
+				t.Fatalf("FastForward failed: %v", err)
+			}
+			if sha, _ := backend.Resolve(repo.Path, "HEAD"); sha != head {
+				t.Errorf("Expected HEAD at %s after fast-forward, got %s", head, sha)
+			}
+			if content, _ := os.ReadFile(index); string(content) != "v3" {
+				t.Errorf("Expected working tree at v3, got %q", content)
+			}
+
+			// An ancestor is already merged, so nothing moves
+			if _, err := backend.FastForward(repo.Path, old); err != nil {
+				t.Fatalf("FastForward to an ancestor failed: %v", err)
+			}
+			if sha, _ := backend.Resolve(repo.Path, "HEAD"); sha != head {
+				t.Errorf("Expected HEAD to stay at %s, got %s", head, sha)
+			}
+
+			// A force push can't be fast-forwarded
+			gitT(t, origin, "checkout", "-q", "--orphan", "rewritten")
+			commitFile(t, origin, "index.html", "rewritten")
+			gitT(t, origin, "branch", "-f", "main", "rewritten")
+			if err := backend.Fetch(repo, repo.Path); err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if n, err := backend.AheadCount(repo.Path, "origin/main", "HEAD"); err != nil || n == 0 {
+				t.Errorf("AheadCount = %d, %v, want diverged history", n, err)
+			}
+			if _, err := backend.FastForward(repo.Path, "origin/main"); err == nil {
+				t.Error("Expected diverged history to refuse a fast-forward")
+			}
+
+			// Only the deployed branch is fetched, but checkout can start another from origin
+			gitT(t, origin, "branch", "-f", "main", head)
+			repo.Branch = "staging"
+			if err := backend.Fetch(repo, repo.Path); err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if err := backend.Checkout(repo.Path, "staging"); err != nil {
+				t.Fatalf("Checkout failed: %v", err)
+			}
+			if branch, _ := backend.CurrentBranch(repo.Path); branch != "staging" {
+				t.Errorf("Expected staging to be checked out, got %q", branch)
+			}
+		})
+	}
+}
+
+func TestGoGitBackendDeploys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app"), GitBackend: GitBackendGoGit}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	head := commitFile(t, origin, "index.html", "v2")
+	monitor.checkRepository(repo)
+
+	history, err := LoadHistory(HistoryFilter{Repo: repo.Path})
+	if err != nil || len(history) != 1 {
+		t.Fatalf("Expected one deployment, got %v, %v", history, err)
+	}
+	if d := history[0]; d.Status != DeployStatusSuccess || d.NewSHA != head || d.CommitCount != 1 {
+		t.Errorf("Unexpected deployment: %+v", d)
+	}
+	if content, _ := os.ReadFile(filepath.Join(repo.Path, "index.html")); string(content) != "v2" {
+		t.Errorf("Expected the working tree to be updated, got %q", content)
+	}
+}
+
+func TestValidateGitBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    Repository
+		global  string
+		wantErr bool
+	}{
+		{"Default", Repository{}, "", false},
+		{"GoGit", Repository{GitBackend: GitBackendGoGit}, "", false},
+		{"GlobalGoGit", Repository{}, GitBackendGoGit, false},
+		{"Unknown", Repository{GitBackend: "libgit2"}, "", true},
+		{"GoGitRelease", Repository{Strategy: StrategyRelease}, GitBackendGoGit, true},
+		{"GoGitTag", Repository{GitBackend: GitBackendGoGit, Tag: "v*"}, "", true},
+		{"GoGitStash", Repository{GitBackend: GitBackendGoGit, OnConflict: ConflictStash}, "", true},
+		{"ExecOverridesGlobal", Repository{GitBackend: GitBackendExec, Tag: "v*"}, GitBackendGoGit, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateGitBackend(tt.repo, tt.global); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateGitBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+const (
+	// defaultFailureThreshold is used when the config doesn't set FailureThreshold
+	defaultFailureThreshold = 5
+	// defaultMaxBackoff is used when the config doesn't set MaxBackoff
+	defaultMaxBackoff = 3600
+
+	failureBaseDelay = time.Minute
+)
+
+// errCheckSkipped is returned by a check that was deliberately cut short,
+// e.g. by a pre_fetch hook, and shouldn't count as a success or a failure
+var errCheckSkipped = errors.New("check skipped")
+
+// FailureState is the persisted failure streak of a repository whose checks
+// keep failing. Once Streak reaches the failure threshold the circuit opens:
+// further failures are only logged at debug level until a check succeeds.
+type FailureState struct {
+	Streak      int       `json:"streak"`
+	LastError   string    `json:"last_error"`
+	Since       time.Time `json:"since"`
+	LastFailure time.Time `json:"last_failure"`
+	// NextCheck is when the poller checks the repository again
+	NextCheck   time.Time `json:"next_check"`
+	CircuitOpen bool      `json:"circuit_open,omitempty"`
+	OpenedAt    time.Time `json:"opened_at,omitempty"`
+}
+
+// FailureThresholdCount returns how many consecutive failures open a repository's circuit
+func (c *Config) FailureThresholdCount() int {
+	if c.FailureThreshold > 0 {
+		return c.FailureThreshold
+	}
+	return defaultFailureThreshold
+}
+
+// MaxBackoffPeriod returns the longest delay between checks of a failing repository
+func (c *Config) MaxBackoffPeriod() time.Duration {
+	if c.MaxBackoff > 0 {
+		return time.Duration(c.MaxBackoff) * time.Second
+	}
+	return defaultMaxBackoff * time.Second
+}
+
+// failureBackoff returns the delay before the next check after streak
+// consecutive failures, doubling after every failure up to max
+func failureBackoff(streak int, max time.Duration) time.Duration {
+	delay := failureBaseDelay
+	for i := 1; i < streak && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// trackCheckResult updates repo's failure streak after a check. The first
+// failure and the one that opens the circuit are logged as errors and run
+// the on_failure hooks; the failures in between are logged as warnings and
+// failures while the circuit is open at debug level, so a repository that
+// stays broken doesn't flood the logs or the alerts.
+func (m *MonitorV2) trackCheckResult(repo Repository, checkErr error, repoLogger *logger.RepoLogger) {
+	if errors.Is(checkErr, errCheckSkipped) {
+		return
+	}
+
+	if checkErr == nil {
+		prev := GetRepoState(repo).Failures
+		if prev == nil {
+			return
+		}
+		UpdateRepoState(repo, func(s *RepoState) { s.Failures = nil })
+		msg := "Repository check recovered"
+		if prev.CircuitOpen {
+			msg = "Repository check recovered, circuit closed"
+		}
+		logInfo(repoLogger, repo, msg,
+			zap.Int("failures", prev.Streak),
+			zap.Time("since", prev.Since))
+		return
+	}
+
+	config := m.currentConfig()
+	now := time.Now()
+	var failure FailureState
+	var opened bool
+	err := UpdateRepoState(repo, func(s *RepoState) {
+		if s.Failures == nil {
+			s.Failures = &FailureState{Since: now}
+		}
+		f := s.Failures
+		f.Streak++
+		f.LastError = checkErr.Error()
+		f.LastFailure = now
+		f.NextCheck = now.Add(failureBackoff(f.Streak, config.MaxBackoffPeriod()))
+		if !f.CircuitOpen && f.Streak >= config.FailureThresholdCount() {
+			f.CircuitOpen = true
+			f.OpenedAt = now
+			opened = true
+		}
+		failure = *f
+	})
+	if err != nil {
+		logger.Warn("Failed to record check failure", zap.String("repo", repo.URL), zap.Error(err))
+	}
+
+	msg := "Repository check failed"
+	if errors.Is(checkErr, errGitTimeout) {
+		msg = "Repository check timed out"
+	}
+	fields := []zap.Field{
+		zap.Int("failures", failure.Streak),
+		zap.Time("next_check", failure.NextCheck),
+		zap.Error(checkErr),
+	}
+
+	alert := checkErr.Error()
+	switch {
+	case opened:
+		logError(repoLogger, repo, "Circuit opened, repository keeps failing",
+			append(fields, zap.Time("since", failure.Since))...)
+		alert = fmt.Sprintf("circuit opened after %d failed checks: %s", failure.Streak, alert)
+	case failure.CircuitOpen:
+		if repoLogger != nil {
+			repoLogger.Debug(msg, fields...)
+		}
+		logger.Debug(msg, append([]zap.Field{zap.String("repo", repo.URL)}, fields...)...)
+		return
+	case failure.Streak == 1:
+		logError(repoLogger, repo, msg, fields...)
+	default:
+		logWarn(repoLogger, repo, msg, fields...)
+		return
+	}
+
+	// A failed fetch or resolve never reaches a deployment, so alert here
+	m.runHooks(repo, HookOnFailure, nil, repoLogger, "SPDEPLOY_ERROR="+alert)
+}
+
+// nextCheckAfter returns when the poller should next check repo: at
+// scheduled, unless the repository is failing and its backoff runs longer
+func nextCheckAfter(repo Repository, scheduled time.Time) time.Time {
+	if f := GetRepoState(repo).Failures; f != nil && f.NextCheck.After(scheduled) {
+		return f.NextCheck
+	}
+	return scheduled
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		streak int
+		want   time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{7, 30 * time.Minute},
+		{50, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := failureBackoff(tt.streak, 30*time.Minute); got != tt.want {
+			t.Errorf("failureBackoff(%d) = %s, want %s", tt.streak, got, tt.want)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	alerts := filepath.Join(t.TempDir(), "alerts")
+	repo := Repository{
+		URL:    origin,
+		Branch: "main",
+		Path:   filepath.Join(t.TempDir(), "app"),
+		Hooks:  &Hooks{OnFailure: []string{"echo \"$SPDEPLOY_ERROR\" | head -n 1 >> " + alerts}},
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, FailureThreshold: 3, Repositories: []Repository{repo}})
+
+	// The deploy path hasn't been cloned yet, so every check fails
+	for i := 1; i <= 4; i++ {
+		before := time.Now()
+		monitor.checkRepository(repo)
+
+		failures := GetRepoState(repo).Failures
+		if failures == nil || failures.Streak != i {
+			t.Fatalf("Check %d: expected a streak of %d, got %+v", i, i, failures)
+		}
+		if wantOpen := i >= 3; failures.CircuitOpen != wantOpen {
+			t.Errorf("Check %d: circuit open = %v, want %v", i, failures.CircuitOpen, wantOpen)
+		}
+		if delay := failures.NextCheck.Sub(before); delay < failureBackoff(i, time.Hour) {
+			t.Errorf("Check %d: next check in %s, want at least %s", i, delay, failureBackoff(i, time.Hour))
+		}
+	}
+	if opened := GetRepoState(repo).Failures.OpenedAt; opened.IsZero() {
+		t.Error("Expected the circuit's opening time to be recorded")
+	}
+
+	// on_failure alerts on the first failure and when the circuit opens
+	data, _ := os.ReadFile(alerts)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "circuit opened after 3 failed checks") {
+		t.Errorf("Expected two on_failure alerts, got %q", data)
+	}
+
+	// A backed-off repository is polled later than its schedule
+	scheduled := time.Now().Add(time.Minute)
+	if next := nextCheckAfter(repo, scheduled); !next.After(scheduled) {
+		t.Errorf("Expected the next check to be delayed past %v, got %v", scheduled, next)
+	}
+
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor.checkRepository(repo)
+	if failures := GetRepoState(repo).Failures; failures != nil {
+		t.Errorf("Expected a successful check to close the circuit, got %+v", failures)
+	}
+	if next := nextCheckAfter(repo, scheduled); !next.Equal(scheduled) {
+		t.Errorf("Expected the schedule to apply again, got %v", next)
+	}
+}
+
+func TestCheckSkippedKeepsStreak(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app")}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	gitDir := filepath.Join(repo.Path, ".git")
+	if err := os.Rename(gitDir, gitDir+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	monitor.checkRepository(repo)
+	if err := os.Rename(gitDir+".moved", gitDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// A vetoing pre_fetch hook is neither a success nor a failure
+	repo.Hooks = &Hooks{PreFetch: []string{"exit 1"}}
+	monitor.checkRepository(repo)
+	if failures := GetRepoState(repo).Failures; failures == nil || failures.Streak != 1 {
+		t.Errorf("Expected the streak to be unchanged, got %+v", failures)
+	}
+}
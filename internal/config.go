@@ -8,8 +8,40 @@ import (
 )
 
 type Config struct {
-	CheckInterval int          `json:"check_interval"`
-	Repositories  []Repository `json:"repositories"`
+	CheckInterval int            `json:"check_interval"`
+	Repositories  []Repository   `json:"repositories"`
+	Webhook       *WebhookConfig `json:"webhook,omitempty"`
+	// Workers is the maximum number of repositories checked concurrently
+	Workers int `json:"workers,omitempty"`
+	// Jitter adds a random delay of up to this many seconds to every check
+	Jitter int `json:"jitter,omitempty"`
+	// ShutdownGrace is how many seconds running deploys get to finish on shutdown
+	ShutdownGrace int `json:"shutdown_grace,omitempty"`
+	// GitTimeout kills a git command after this many seconds (default 300)
+	GitTimeout int `json:"git_timeout,omitempty"`
+	// GitBackend selects how git operations run: "exec" (default) or "go-git"
+	GitBackend string `json:"git_backend,omitempty"`
+	// SharedMirrors fetches each remote URL into one bare mirror under
+	// ~/.spdeploy/mirrors and updates every deploy path of it from there
+	SharedMirrors bool `json:"shared_mirrors,omitempty"`
+	// FailureThreshold is how many consecutive failed checks open a repository's circuit (default 5)
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	// MaxBackoff caps the delay between checks of a failing repository, in seconds (default 3600)
+	MaxBackoff int `json:"max_backoff,omitempty"`
+}
+
+const (
+	// defaultWorkers is used when the config doesn't set Workers
+	defaultWorkers = 4
+	// defaultShutdownGrace is used when the config doesn't set ShutdownGrace
+	defaultShutdownGrace = 30
+)
+
+// WebhookConfig enables an HTTP listener that triggers checks on push events
+type WebhookConfig struct {
+	Listen string `json:"listen"`
+	Path   string `json:"path,omitempty"`
+	Secret string `json:"secret,omitempty"`
 }
 
 type Repository struct {
@@ -17,6 +49,82 @@ type Repository struct {
 	Branch         string `json:"branch"`
 	Path           string `json:"path"`
 	PostPullScript string `json:"post_pull_script,omitempty"`
+
+	// Tag is a glob pattern, e.g. "v*"; when set, the highest matching tag by
+	// semantic version is deployed instead of the head of Branch
+	Tag string `json:"tag,omitempty"`
+	// Prerelease lets tag tracking deploy pre-release versions such as v2.0.0-rc.1
+	Prerelease bool `json:"prerelease,omitempty"`
+
+	// IncludePaths and ExcludePaths are globs relative to the repository root.
+	// When either is set, an update touching no included, non-excluded path
+	// is applied without running hooks or the post-pull script.
+	IncludePaths []string `json:"include_paths,omitempty"`
+	ExcludePaths []string `json:"exclude_paths,omitempty"`
+
+	// RequireSigned refuses updates whose commits lack a valid signature:
+	// "tip" checks the commit being deployed, "all" every incoming commit.
+	// SSH signatures are checked against AllowedSigners, an ssh-keygen
+	// allowed signers file, and GPG signatures against the public keys in
+	// GPGKeyring.
+	RequireSigned  string `json:"require_signed,omitempty"`
+	AllowedSigners string `json:"allowed_signers,omitempty"`
+	GPGKeyring     string `json:"gpg_keyring,omitempty"`
+
+	// Directives overrides the commit message tokens that skip a deploy,
+	// skip its post-pull script or force the script to run
+	Directives *Directives `json:"directives,omitempty"`
+
+	// Depth limits clones and fetches to that many commits of history;
+	// SparsePaths limits the working tree to those directories
+	Depth       int      `json:"depth,omitempty"`
+	SparsePaths []string `json:"sparse_paths,omitempty"`
+
+	// Submodules, when "recursive", checks out submodules after every clone
+	// and update; LFS downloads Git LFS files instead of leaving pointers
+	Submodules string `json:"submodules,omitempty"`
+	LFS        bool   `json:"lfs,omitempty"`
+
+	// OnConflict is what to do when local changes or diverged history block
+	// an update: "fail" (default), "stash" or "reset"
+	OnConflict string `json:"on_conflict,omitempty"`
+
+	// TokenEnv names the environment variable holding the token for an HTTPS remote
+	TokenEnv string `json:"token_env,omitempty"`
+	// GitTimeout overrides the global git timeout, in seconds
+	GitTimeout int `json:"git_timeout,omitempty"`
+	// GitBackend overrides the global git backend
+	GitBackend string `json:"git_backend,omitempty"`
+	// SSHKey is the private key used for an SSH remote instead of the daemon user's default
+	SSHKey string `json:"ssh_key,omitempty"`
+	// KnownHosts replaces ~/.ssh/known_hosts for an SSH remote
+	KnownHosts string `json:"known_hosts,omitempty"`
+	// StrictHostKeyChecking is passed to ssh: "yes", "no" or "accept-new"
+	StrictHostKeyChecking string `json:"strict_host_key_checking,omitempty"`
+
+	// Interval overrides the global check interval, in seconds
+	Interval int `json:"interval,omitempty"`
+	// Schedule is a cron expression (e.g. "0 * * * *" or "@hourly") used instead of an interval
+	Schedule string `json:"schedule,omitempty"`
+	// Jitter overrides the global jitter, in seconds
+	Jitter int `json:"jitter,omitempty"`
+
+	// ScriptInterpreter overrides the script's shebang, e.g. "bash -e"
+	ScriptInterpreter string `json:"script_interpreter,omitempty"`
+	// ScriptTimeout kills the script's process group after this many seconds (0 = no limit)
+	ScriptTimeout int `json:"script_timeout,omitempty"`
+	// ScriptRetries is how many times a failed post-pull script is retried
+	// for the same commit (0 = default of 5, negative = never retry)
+	ScriptRetries int `json:"script_retries,omitempty"`
+	// Hooks are extra commands run at each deploy stage
+	Hooks *Hooks `json:"hooks,omitempty"`
+
+	// Strategy selects how changes are deployed: "pull" (default) updates
+	// Path in place, "release" checks out each commit into Path/releases
+	// and switches the Path/current symlink once the script succeeds
+	Strategy     string   `json:"strategy,omitempty"`
+	SharedPaths  []string `json:"shared_paths,omitempty"`
+	KeepReleases int      `json:"keep_releases,omitempty"`
 }
 
 func getConfigPath() string {
@@ -51,9 +159,120 @@ func LoadConfig() *Config {
 		config.CheckInterval = 60
 	}
 
+	for i := range config.Repositories {
+		repo := &config.Repositories[i]
+		if repo.Interval > 0 && repo.Interval < minCheckInterval {
+			fmt.Fprintf(os.Stderr, "Warning: Interval for %s raised to the minimum of %ds\n", repo.Path, minCheckInterval)
+			repo.Interval = minCheckInterval
+		}
+		if err := ValidateSchedule(*repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Ignoring schedule for %s: %v\n", repo.Path, err)
+			repo.Schedule = ""
+		}
+		if redactCredentials(repo.URL) != repo.URL {
+			fmt.Fprintf(os.Stderr, "Warning: URL for %s contains credentials; move the token to the environment or %s\n", repo.Path, getCredentialsPath())
+		}
+	}
+
+	setGitDefaults(config)
 	return config
 }
 
+// ReadConfig reads the config file like LoadConfig, but returns an error
+// instead of falling back to defaults when the file can't be used. The
+// daemon uses it so a broken edit never replaces a working configuration.
+func ReadConfig() (*Config, error) {
+	config := &Config{
+		CheckInterval: 60,
+		Repositories:  []Repository{},
+	}
+
+	data, err := os.ReadFile(getConfigPath())
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
+
+	if config.CheckInterval < 10 {
+		config.CheckInterval = 60
+	}
+	for i := range config.Repositories {
+		if repo := &config.Repositories[i]; repo.Interval > 0 && repo.Interval < minCheckInterval {
+			repo.Interval = minCheckInterval
+		}
+	}
+
+	return config, nil
+}
+
+// validateConfig checks the settings the monitor can't safely run without
+func validateConfig(config *Config) error {
+	if hook := config.Webhook; hook != nil && hook.Listen != "" && hook.Secret == "" {
+		return fmt.Errorf("webhook: secret is required, otherwise anyone who can reach %s can trigger deploys", hook.Listen)
+	}
+
+	paths := make(map[string]bool)
+	for i, repo := range config.Repositories {
+		if repo.URL == "" || repo.Path == "" {
+			return fmt.Errorf("repository %d: url and path are required", i+1)
+		}
+		if _, err := RemoteTransport(repo.URL); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if redactCredentials(repo.URL) != repo.URL {
+			return fmt.Errorf("repository %s: URL must not contain credentials", repo.Path)
+		}
+		if err := ValidateConflictPolicy(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if err := ValidateTagPattern(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if err := validateSSHOptions(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if err := ValidateDepthAndSparse(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if err := ValidateScriptInterpreter(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if err := ValidateCheckoutExtras(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if err := ValidateSignedPolicy(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if err := ValidateWatchPaths(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if err := ValidateGitBackend(repo, config.GitBackend); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		if repo.Strategy != "" && repo.Strategy != StrategyPull && repo.Strategy != StrategyRelease {
+			return fmt.Errorf("repository %s: unknown strategy %q", repo.Path, repo.Strategy)
+		}
+		if err := ValidateSchedule(repo); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.Path, err)
+		}
+		key := stateKey(repo)
+		if paths[key] {
+			return fmt.Errorf("repository %s: path is configured more than once", repo.Path)
+		}
+		paths[key] = true
+	}
+	return nil
+}
+
 func SaveConfig(config *Config) error {
 	configPath := getConfigPath()
 
@@ -62,9 +281,40 @@ func SaveConfig(config *Config) error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	// Write atomically so a running daemon never reloads a half-written file
+	tmp := configPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Rename(tmp, configPath); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// FindRepository looks up a configured repository by deploy path or URL.
+// A URL that is deployed to several paths is ambiguous and must be given as a path.
+func FindRepository(config *Config, ident string) (*Repository, error) {
+	absIdent, _ := filepath.Abs(ident)
+
+	var matches []*Repository
+	for i := range config.Repositories {
+		repo := &config.Repositories[i]
+		if absPath, _ := filepath.Abs(repo.Path); absPath == absIdent {
+			return repo, nil
+		}
+		if repo.URL == ident {
+			matches = append(matches, repo)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("repository not found: %s", ident)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%s is deployed to %d paths, specify the path instead", ident, len(matches))
+	}
+}
@@ -107,4 +107,64 @@ func TestGetConfigPath(t *testing.T) {
 	if actualPath != expectedPath {
 		t.Errorf("Expected config path to be '%s', got '%s'", expectedPath, actualPath)
 	}
+}
+
+func TestLoadConfigRepositorySchedules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cfg := &Config{
+		CheckInterval: 60,
+		Repositories: []Repository{
+			{URL: "git@github.com:test/api.git", Branch: "main", Path: "/srv/api", Interval: 3},
+			{URL: "git@github.com:test/docs.git", Branch: "main", Path: "/srv/docs", Schedule: "not a schedule"},
+			{URL: "git@github.com:test/site.git", Branch: "main", Path: "/srv/site", Schedule: "@hourly", Jitter: 30},
+		},
+	}
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	loaded := LoadConfig()
+	if got := loaded.Repositories[0].Interval; got != minCheckInterval {
+		t.Errorf("Expected interval to be raised to %d, got %d", minCheckInterval, got)
+	}
+	if got := loaded.Repositories[1].Schedule; got != "" {
+		t.Errorf("Expected invalid schedule to be dropped, got %q", got)
+	}
+	if got := loaded.Repositories[2]; got.Schedule != "@hourly" || got.Jitter != 30 {
+		t.Errorf("Expected schedule and jitter to be kept, got %q/%d", got.Schedule, got.Jitter)
+	}
+}
+
+func TestReadConfigValidation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// A missing config is not an error
+	if cfg, err := ReadConfig(); err != nil || cfg.CheckInterval != 60 {
+		t.Fatalf("Expected default config, got %+v (%v)", cfg, err)
+	}
+
+	tests := []struct {
+		name    string
+		repos   []Repository
+		webhook *WebhookConfig
+	}{
+		{"MissingPath", []Repository{{URL: "git@github.com:test/a.git", Branch: "main"}}, nil},
+		{"UnknownStrategy", []Repository{{URL: "git@github.com:test/a.git", Branch: "main", Path: "/srv/a", Strategy: "copy"}}, nil},
+		{"DuplicatePath", []Repository{
+			{URL: "git@github.com:test/a.git", Branch: "main", Path: "/srv/a"},
+			{URL: "git@github.com:test/b.git", Branch: "main", Path: "/srv/a"},
+		}, nil},
+		{"WebhookWithoutSecret", nil, &WebhookConfig{Listen: ":9000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SaveConfig(&Config{CheckInterval: 60, Repositories: tt.repos, Webhook: tt.webhook}); err != nil {
+				t.Fatalf("Failed to save config: %v", err)
+			}
+			if _, err := ReadConfig(); err == nil {
+				t.Error("Expected ReadConfig to reject the config")
+			}
+		})
+	}
 }
\ No newline at end of file
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// Policies for a working copy that can't be fast-forwarded, set with on_conflict
+const (
+	// ConflictFail leaves the working copy alone and reports the conflict
+	ConflictFail = "fail"
+	// ConflictStash stashes local changes and re-applies them after the update
+	ConflictStash = "stash"
+	// ConflictReset backs up local changes and commits to a patch, then hard-resets
+	ConflictReset = "reset"
+)
+
+// ConflictPolicies lists every supported on_conflict policy
+var ConflictPolicies = []string{ConflictFail, ConflictStash, ConflictReset}
+
+var errConflict = errors.New("working copy conflicts with the update")
+
+// ConflictState records an update blocked by local changes or diverged history
+type ConflictState struct {
+	SHA    string    `json:"sha"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+}
+
+// treeConflict is what stands in the way of fast-forwarding a working copy
+type treeConflict struct {
+	// dirty means tracked files have local modifications
+	dirty bool
+	// diverged means HEAD has commits the target doesn't, from local commits or a force push upstream
+	diverged bool
+}
+
+func (c treeConflict) any() bool { return c.dirty || c.diverged }
+
+func (c treeConflict) String() string {
+	var reasons []string
+	if c.dirty {
+		reasons = append(reasons, "local changes")
+	}
+	if c.diverged {
+		reasons = append(reasons, "diverged history")
+	}
+	return strings.Join(reasons, " and ")
+}
+
+// ValidateConflictPolicy checks repo's on_conflict setting
+func ValidateConflictPolicy(repo Repository) error {
+	switch repo.OnConflict {
+	case "", ConflictFail, ConflictStash, ConflictReset:
+		return nil
+	}
+	return fmt.Errorf("on_conflict must be one of %s", strings.Join(ConflictPolicies, ", "))
+}
+
+// detectConflict compares the working copy in repo.Path with target. Only
+// branch checkouts can diverge; a detached tag checkout is simply moved.
+func detectConflict(repo Repository, target string) (treeConflict, error) {
+	var c treeConflict
+	backend := backendFor(repo)
+
+	dirty, err := backend.HasLocalChanges(repo.Path)
+	if err != nil {
+		return c, err
+	}
+	c.dirty = dirty
+
+	if repo.Tag == "" {
+		// Commits on HEAD that target lacks can't be fast-forwarded
+		ahead, err := backend.AheadCount(repo.Path, target, "HEAD")
+		if err != nil {
+			return c, fmt.Errorf("failed to compare HEAD with %s: %w", target, err)
+		}
+		c.diverged = ahead > 0
+	}
+	return c, nil
+}
+
+// conflictError returns the error for c if repo's policy can't resolve it, or nil
+func conflictError(repo Repository, c treeConflict) error {
+	if !c.any() {
+		return nil
+	}
+	switch repo.OnConflict {
+	case ConflictReset:
+		return nil
+	case ConflictStash:
+		if !c.diverged {
+			return nil
+		}
+		return fmt.Errorf("%w: %s (stash can't resolve diverged history; use on_conflict reset)", errConflict, c)
+	}
+	return fmt.Errorf("%w: %s", errConflict, c)
+}
+
+// reportConflict records an update blocked by err. The deployment is recorded
+// and on_failure hooks run once per target commit; later checks only log.
+func (m *MonitorV2) reportConflict(repo Repository, oldSHA, newSHA, tag string, err error, repoLogger *logger.RepoLogger) {
+	if prev := GetRepoState(repo).Conflict; prev != nil && prev.SHA == newSHA && prev.Reason == err.Error() {
+		logWarn(repoLogger, repo, "Update still blocked by conflict",
+			zap.String("new_sha", newSHA),
+			zap.Error(err))
+		return
+	}
+
+	logError(repoLogger, repo, "Update blocked by conflict, fix the working copy or set on_conflict",
+		zap.String("old_sha", oldSHA),
+		zap.String("new_sha", newSHA),
+		zap.Error(err))
+
+	deploy := newDeployment(repo, DeployKindDeploy)
+	deploy.Tag = tag
+	deploy.OldSHA = oldSHA
+	deploy.NewSHA = newSHA
+	deploy.CommitCount = countCommits(repo, repo.Path, oldSHA, newSHA)
+	m.finishDeployment(repo, deploy, err, repoLogger)
+	m.recordDeployment(deploy)
+
+	if err := UpdateRepoState(repo, func(s *RepoState) {
+		s.Conflict = &ConflictState{SHA: newSHA, Reason: err.Error(), Since: deploy.StartedAt}
+	}); err != nil {
+		logWarn(repoLogger, repo, "Failed to save conflict state", zap.Error(err))
+	}
+}
+
+// clearConflict forgets a previously reported conflict once it no longer applies
+func clearConflict(repo Repository) {
+	if GetRepoState(repo).Conflict != nil {
+		UpdateRepoState(repo, func(s *RepoState) { s.Conflict = nil })
+	}
+}
+
+// updateWorkingTree moves repo.Path to target with update, first applying
+// repo's on_conflict policy to c. The caller has checked conflictError.
+func (m *MonitorV2) updateWorkingTree(repo Repository, deploy *Deployment, target string, c treeConflict, update func() (string, error), repoLogger *logger.RepoLogger) (string, error) {
+	if !c.any() {
+		return update()
+	}
+
+	if repo.OnConflict == ConflictReset {
+		backup, err := backupLocalChanges(repo, target, c, deploy.ID)
+		if err != nil {
+			return "", fmt.Errorf("failed to back up local changes: %w", err)
+		}
+		deploy.Backup = backup
+		logWarn(repoLogger, repo, "Discarding local changes",
+			zap.String("conflict", c.String()),
+			zap.String("backup", backup))
+		return runGit(repo.Path, "reset", "--hard", target)
+	}
+
+	// ConflictStash; diverged history was rejected by conflictError
+	if _, err := runGit(repo.Path, "stash", "push", "-m", "spdeploy "+deploy.ID); err != nil {
+		return "", fmt.Errorf("failed to stash local changes: %w", err)
+	}
+	logInfo(repoLogger, repo, "Stashed local changes")
+
+	output, err := update()
+	if _, popErr := runGit(repo.Path, "stash", "pop"); popErr != nil {
+		// Leave a clean checkout rather than conflict markers; git keeps the
+		// changes in the stash when pop fails
+		runGit(repo.Path, "reset", "--hard", "HEAD")
+		logWarn(repoLogger, repo, "Local changes conflict with the update and were left in the stash",
+			zap.Error(popErr))
+	} else {
+		logInfo(repoLogger, repo, "Re-applied local changes")
+	}
+	return output, err
+}
+
+func getBackupsDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".spdeploy", "backups")
+}
+
+// backupLocalChanges writes everything a hard reset to target would discard
+// as a patch: uncommitted changes plus, when history diverged, the commits
+// target doesn't have. It returns the patch path.
+func backupLocalChanges(repo Repository, target string, c treeConflict, id string) (string, error) {
+	base := "HEAD"
+	if c.diverged {
+		// A rewritten history may share nothing with HEAD; then the patch
+		// recreates the local state on top of target
+		base = target
+		if mergeBase, err := runGit(repo.Path, "merge-base", "HEAD", target); err == nil {
+			base = mergeBase
+		}
+	}
+
+	// Not runGit: the patch must be kept byte for byte
+	cmd := newGitCmd(gitTimeout(nil), repo.Path, "diff", "--binary", base)
+	defer cmd.release()
+	patch, err := cmd.Output()
+	if err := cmd.wrap(err); err != nil {
+		return "", fmt.Errorf("git diff failed: %w", err)
+	}
+
+	if err := os.MkdirAll(getBackupsDir(), 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(getBackupsDir(), fmt.Sprintf("%s-%s.patch", filepath.Base(repo.Path), id))
+	if err := os.WriteFile(path, patch, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
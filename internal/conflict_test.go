@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newConflictRepo clones a fresh origin and returns both with a monitor for the clone
+func newConflictRepo(t *testing.T, policy string) (string, Repository, *MonitorV2) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	repo := Repository{
+		URL:        origin,
+		Branch:     "main",
+		Path:       filepath.Join(t.TempDir(), "app"),
+		OnConflict: policy,
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	gitT(t, repo.Path, "config", "user.email", "server@example.com")
+	gitT(t, repo.Path, "config", "user.name", "Server")
+	return origin, repo, NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+}
+
+func TestConflictFail(t *testing.T) {
+	origin, repo, monitor := newConflictRepo(t, "")
+	before := gitT(t, repo.Path, "rev-parse", "HEAD")
+
+	os.WriteFile(filepath.Join(repo.Path, "index.html"), []byte("hotfix"), 0644)
+	newSHA := commitFile(t, origin, "app.js", "v2")
+
+	monitor.checkRepository(repo)
+	monitor.checkRepository(repo)
+
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != before {
+		t.Errorf("Expected HEAD to stay at %s, got %s", before, head)
+	}
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path})
+	if len(history) != 1 || history[0].Status != DeployStatusConflict {
+		t.Fatalf("Expected one conflict deployment, got %+v", history)
+	}
+	conflict := GetRepoState(repo).Conflict
+	if conflict == nil || conflict.SHA != newSHA || !strings.Contains(conflict.Reason, "local changes") {
+		t.Errorf("Expected conflict state for %s, got %+v", newSHA, conflict)
+	}
+
+	// Once the working copy is clean the update goes through and the conflict is cleared
+	gitT(t, repo.Path, "checkout", "--", "index.html")
+	monitor.checkRepository(repo)
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != newSHA {
+		t.Errorf("Expected HEAD at %s, got %s", newSHA, head)
+	}
+	if conflict := GetRepoState(repo).Conflict; conflict != nil {
+		t.Errorf("Expected conflict to be cleared, got %+v", conflict)
+	}
+}
+
+func TestConflictDivergedNeverMerges(t *testing.T) {
+	origin, repo, monitor := newConflictRepo(t, ConflictStash)
+
+	local := commitFile(t, repo.Path, "local.txt", "server commit")
+	commitFile(t, origin, "app.js", "v2")
+
+	monitor.checkRepository(repo)
+
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != local {
+		t.Errorf("Expected HEAD to stay at the local commit, got %s", head)
+	}
+	if parents := gitT(t, repo.Path, "rev-list", "--merges", "--count", "HEAD"); parents != "0" {
+		t.Errorf("Expected no merge commits, found %s", parents)
+	}
+	if conflict := GetRepoState(repo).Conflict; conflict == nil || !strings.Contains(conflict.Reason, "diverged") {
+		t.Errorf("Expected diverged conflict, got %+v", conflict)
+	}
+}
+
+func TestConflictStash(t *testing.T) {
+	origin, repo, monitor := newConflictRepo(t, ConflictStash)
+
+	t.Run("Reapplied", func(t *testing.T) {
+		os.WriteFile(filepath.Join(repo.Path, "index.html"), []byte("hotfix"), 0644)
+		newSHA := commitFile(t, origin, "app.js", "v2")
+
+		monitor.checkRepository(repo)
+
+		if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != newSHA {
+			t.Fatalf("Expected HEAD at %s, got %s", newSHA, head)
+		}
+		if data, _ := os.ReadFile(filepath.Join(repo.Path, "index.html")); string(data) != "hotfix" {
+			t.Errorf("Expected local change to be re-applied, got %q", data)
+		}
+	})
+
+	t.Run("LeftInStash", func(t *testing.T) {
+		newSHA := commitFile(t, origin, "index.html", "v3")
+
+		monitor.checkRepository(repo)
+
+		if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != newSHA {
+			t.Fatalf("Expected HEAD at %s, got %s", newSHA, head)
+		}
+		if status := gitT(t, repo.Path, "status", "--porcelain", "--untracked-files=no"); status != "" {
+			t.Errorf("Expected a clean working tree, got %q", status)
+		}
+		if stash := gitT(t, repo.Path, "stash", "list"); !strings.Contains(stash, "spdeploy") {
+			t.Errorf("Expected local changes to be kept in the stash, got %q", stash)
+		}
+	})
+}
+
+func TestConflictReset(t *testing.T) {
+	origin, repo, monitor := newConflictRepo(t, ConflictReset)
+
+	commitFile(t, repo.Path, "local.txt", "server commit")
+	os.WriteFile(filepath.Join(repo.Path, "index.html"), []byte("hotfix"), 0644)
+
+	// Force-push upstream: rewrite the only commit
+	gitT(t, origin, "commit", "--amend", "-m", "Rewritten")
+	newSHA := gitT(t, origin, "rev-parse", "HEAD")
+
+	monitor.checkRepository(repo)
+
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != newSHA {
+		t.Fatalf("Expected HEAD reset to %s, got %s", newSHA, head)
+	}
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path})
+	if len(history) != 1 || history[0].Status != DeployStatusSuccess || history[0].Backup == "" {
+		t.Fatalf("Expected a successful deployment with a backup, got %+v", history)
+	}
+	patch, err := os.ReadFile(history[0].Backup)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	if !strings.Contains(string(patch), "+server commit") || !strings.Contains(string(patch), "+hotfix") {
+		t.Errorf("Backup is missing the discarded changes:\n%s", patch)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"syscall"
+	"time"
 )
 
 func getPIDFilePath() string {
@@ -80,13 +81,24 @@ func StopDaemon() error {
 		return fmt.Errorf("failed to stop daemon: %w", err)
 	}
 
-	// Remove PID file
-	pidFile := getPIDFilePath()
-	os.Remove(pidFile)
-
+	// The daemon removes its PID file once running deploys have finished,
+	// so IsDaemonRunning stays true while it shuts down
 	return nil
 }
 
+// WaitForDaemonExit polls until the daemon has exited, returning false if it
+// is still running after timeout
+func WaitForDaemonExit(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for IsDaemonRunning() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return true
+}
+
 func CleanupDaemonPID() {
 	// Only cleanup if the PID file exists and it's our process
 	pid, err := readDaemonPID()
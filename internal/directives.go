@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// Commit message directives
+const (
+	// DirectiveSkip updates the working copy without running hooks or the post-pull script
+	DirectiveSkip = "skip"
+	// DirectiveNoScript deploys without running the post-pull script
+	DirectiveNoScript = "no_script"
+	// DirectiveForceScript deploys with the post-pull script even if no watched path changed
+	DirectiveForceScript = "force_script"
+)
+
+// DirectiveKinds lists the directives in the order they are documented
+var DirectiveKinds = []string{DirectiveSkip, DirectiveNoScript, DirectiveForceScript}
+
+// Directives holds the tokens that mark a commit message with each
+// directive. A kind left unset uses the default tokens; an empty list
+// disables it.
+type Directives struct {
+	Skip        []string `json:"skip"`
+	NoScript    []string `json:"no_script"`
+	ForceScript []string `json:"force_script"`
+}
+
+// defaultDirectives are the tokens recognised when a repository doesn't set its own
+var defaultDirectives = Directives{
+	Skip:        []string{"[skip deploy]", "[deploy skip]"},
+	NoScript:    []string{"[deploy:no-script]"},
+	ForceScript: []string{"[deploy:force-script]"},
+}
+
+// Add appends token to the directive kind
+func (d *Directives) Add(kind, token string) error {
+	switch kind {
+	case DirectiveSkip:
+		d.Skip = append(d.Skip, token)
+	case DirectiveNoScript:
+		d.NoScript = append(d.NoScript, token)
+	case DirectiveForceScript:
+		d.ForceScript = append(d.ForceScript, token)
+	default:
+		return fmt.Errorf("unknown directive %q", kind)
+	}
+	return nil
+}
+
+// Tokens returns the tokens for kind, falling back to the defaults. It is
+// safe to call on a nil *Directives.
+func (d *Directives) Tokens(kind string) []string {
+	var tokens, defaults []string
+	switch kind {
+	case DirectiveSkip:
+		defaults = defaultDirectives.Skip
+		if d != nil {
+			tokens = d.Skip
+		}
+	case DirectiveNoScript:
+		defaults = defaultDirectives.NoScript
+		if d != nil {
+			tokens = d.NoScript
+		}
+	case DirectiveForceScript:
+		defaults = defaultDirectives.ForceScript
+		if d != nil {
+			tokens = d.ForceScript
+		}
+	}
+	if tokens == nil {
+		return defaults
+	}
+	return tokens
+}
+
+// hasDirective reports whether message contains one of kind's tokens,
+// ignoring case
+func (d *Directives) hasDirective(kind, message string) bool {
+	message = strings.ToLower(message)
+	for _, token := range d.Tokens(kind) {
+		if token != "" && strings.Contains(message, strings.ToLower(token)) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeDirective combines the directives of the incoming commits' messages.
+// One commit asking for the script forces it. Skipping, or deploying
+// without the script, needs every commit to ask for it, so a README fix
+// pushed together with a real change still deploys.
+func rangeDirective(d *Directives, messages []string) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	skip, noScript := true, true
+	for _, message := range messages {
+		if d.hasDirective(DirectiveForceScript, message) {
+			return DirectiveForceScript
+		}
+		isSkip := d.hasDirective(DirectiveSkip, message)
+		skip = skip && isSkip
+		noScript = noScript && (isSkip || d.hasDirective(DirectiveNoScript, message))
+	}
+	switch {
+	case skip:
+		return DirectiveSkip
+	case noScript:
+		return DirectiveNoScript
+	}
+	return ""
+}
+
+// commitDirective reads the messages of the commits between oldSHA and
+// newSHA and returns the directive they carry, or "" for a normal deploy
+func commitDirective(repo Repository, oldSHA, newSHA string, repoLogger *logger.RepoLogger) (string, error) {
+	messages, err := backendFor(repo).CommitMessages(gitDirFor(repo), oldSHA, newSHA)
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit messages: %w", err)
+	}
+	directive := rangeDirective(repo.Directives, messages)
+	if directive != "" {
+		logInfo(repoLogger, repo, "Commit message directive found",
+			zap.String("directive", directive),
+			zap.Int("commits", len(messages)))
+	}
+	return directive, nil
+}
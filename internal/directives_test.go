@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRangeDirective(t *testing.T) {
+	custom := &Directives{Skip: []string{"[nodeploy]"}, NoScript: []string{}}
+	tests := []struct {
+		name       string
+		directives *Directives
+		messages   []string
+		want       string
+	}{
+		{"None", nil, []string{"Fix login"}, ""},
+		{"Skip", nil, []string{"Fix typo in README [skip deploy]"}, DirectiveSkip},
+		{"SkipIgnoresCase", nil, []string{"[Skip Deploy] docs"}, DirectiveSkip},
+		{"SkipNeedsEveryCommit", nil, []string{"Docs [skip deploy]", "Fix login"}, ""},
+		{"NoScript", nil, []string{"Tweak CSS [deploy:no-script]"}, DirectiveNoScript},
+		{"SkipAndNoScript", nil, []string{"Docs [skip deploy]", "CSS [deploy:no-script]"}, DirectiveNoScript},
+		{"ForceWins", nil, []string{"Docs [skip deploy]", "Rebuild [deploy:force-script]"}, DirectiveForceScript},
+		{"CustomToken", custom, []string{"Docs [nodeploy]"}, DirectiveSkip},
+		{"CustomReplacesDefault", custom, []string{"Docs [skip deploy]"}, ""},
+		{"DisabledKind", custom, []string{"CSS [deploy:no-script]"}, ""},
+		{"DefaultForUnsetKind", custom, []string{"[deploy:force-script]"}, DirectiveForceScript},
+		{"NoCommits", nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rangeDirective(tt.directives, tt.messages); got != tt.want {
+				t.Errorf("rangeDirective() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitDirectives(t *testing.T) {
+	for _, backend := range []string{GitBackendExec, GitBackendGoGit} {
+		t.Run(backend, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+
+			origin := newTestOrigin(t)
+			commitFile(t, origin, "deploy.sh", "#!/bin/sh\necho \"$SPDEPLOY_NEW_SHA\" >> \"$HOME/deploys\"\n")
+
+			repo := Repository{
+				URL:            origin,
+				Branch:         "main",
+				Path:           filepath.Join(t.TempDir(), "app"),
+				PostPullScript: "deploy.sh",
+				GitBackend:     backend,
+				IncludePaths:   []string{"src/"},
+			}
+			if err := ValidateRepository(repo); err != nil {
+				t.Fatalf("ValidateRepository failed: %v", err)
+			}
+			monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+			deploys := filepath.Join(os.Getenv("HOME"), "deploys")
+
+			push := func(file, message string) string {
+				os.MkdirAll(filepath.Join(origin, filepath.Dir(file)), 0755)
+				os.WriteFile(filepath.Join(origin, file), []byte(message), 0644)
+				gitT(t, origin, "add", ".")
+				gitT(t, origin, "commit", "-m", message)
+				return gitT(t, origin, "rev-parse", "HEAD")
+			}
+			check := func(wantStatus, wantDirective string, wantScript bool) {
+				t.Helper()
+				os.Remove(deploys)
+				monitor.checkRepository(repo)
+				history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+				if len(history) != 1 || history[0].Status != wantStatus || history[0].Directive != wantDirective {
+					t.Fatalf("Expected a %s deployment with directive %q, got %+v", wantStatus, wantDirective, history)
+				}
+				if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != history[0].NewSHA {
+					t.Errorf("Expected HEAD at %s, got %s", history[0].NewSHA, head)
+				}
+				if ran := fileExists(deploys); ran != wantScript {
+					t.Errorf("Script ran = %v, want %v", ran, wantScript)
+				}
+			}
+
+			push("src/app.go", "Reword comment [skip deploy]")
+			check(DeployStatusSkipped, DirectiveSkip, false)
+
+			push("src/app.go", "Tweak styles [deploy:no-script]")
+			check(DeployStatusSuccess, DirectiveNoScript, false)
+
+			// Forcing the script overrides the watched paths
+			push("README", "Rebuild caches [deploy:force-script]")
+			check(DeployStatusSuccess, DirectiveForceScript, true)
+
+			push("src/app.go", "Fix login")
+			check(DeployStatusSuccess, "", true)
+		})
+	}
+}
+
+func TestReleaseDirectives(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	commitFile(t, origin, "deploy.sh", "#!/bin/sh\necho \"$SPDEPLOY_NEW_SHA\" >> \"$HOME/deploys\"\n")
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "site"),
+		PostPullScript: "deploy.sh",
+		Strategy:       StrategyRelease,
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.checkRepository(repo)
+	deploys := filepath.Join(os.Getenv("HOME"), "deploys")
+
+	push := func(message string) string {
+		os.WriteFile(filepath.Join(origin, "index.html"), []byte(message), 0644)
+		gitT(t, origin, "commit", "-qam", message)
+		return gitT(t, origin, "rev-parse", "HEAD")
+	}
+	history := func() []Deployment {
+		h, _ := LoadHistory(HistoryFilter{Repo: repo.Path})
+		return h
+	}
+
+	// A skipped release is recorded once and never activated
+	live := currentReleaseSHA(repo)
+	push("Reword comment [skip deploy]")
+	before := len(history())
+	monitor.checkRepository(repo)
+	monitor.checkRepository(repo)
+	if got := history(); len(got) != before+1 || got[0].Status != DeployStatusSkipped || got[0].Directive != DirectiveSkip {
+		t.Fatalf("Expected one skipped release, got %d records, latest %+v", len(got)-before, got[0])
+	}
+	if current := currentReleaseSHA(repo); current != live {
+		t.Errorf("Expected %s to stay live, got %s", live, current)
+	}
+
+	os.Remove(deploys)
+	head := push("Tweak styles [deploy:no-script]")
+	monitor.checkRepository(repo)
+	if got := history(); got[0].Status != DeployStatusSuccess || got[0].Directive != DirectiveNoScript {
+		t.Fatalf("Expected a release without script, got %+v", got[0])
+	}
+	if current := currentReleaseSHA(repo); current != head {
+		t.Errorf("Expected %s to be live, got %s", head, current)
+	}
+	if fileExists(deploys) {
+		t.Error("Expected the script not to run")
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func getLocksDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".spdeploy", "locks")
+}
+
+// repoLockPath returns the lock file guarding repo's deploy path across
+// processes, named after the path and a hash of it
+func repoLockPath(repo Repository) string {
+	key := stateKey(repo)
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(getLocksDir(), fmt.Sprintf("%s-%x.lock", filepath.Base(key), sum[:4]))
+}
+
+// lockFile takes an exclusive lock on path, creating it if needed, and
+// waits while another process holds it. The lock is released by the
+// returned function, or when the process exits.
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock %s: %w", path, err)
+	}
+	if err := lockFD(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return func() {
+		unlockFD(f)
+		f.Close()
+	}, nil
+}
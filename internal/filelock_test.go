@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "state.json.lock")
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatalf("lockFile failed: %v", err)
+	}
+
+	// A second open file, like another process, waits for the first holder
+	acquired := make(chan func())
+	go func() {
+		unlock, err := lockFile(path)
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- unlock
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected the second lock to wait while the first is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case unlock2 := <-acquired:
+		if unlock2 != nil {
+			unlock2()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the second lock once the first was released")
+	}
+}
@@ -1,13 +1,77 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// defaultGitTimeout is used when neither the config nor the repository sets git_timeout, in seconds
+const defaultGitTimeout = 300
+
+// errGitTimeout marks a git command killed for running longer than its timeout
+var errGitTimeout = errors.New("git command timed out")
+
+// globalGitTimeout is the config's git_timeout in seconds. It is updated
+// whenever the config is loaded, since git runs far from the config.
+var globalGitTimeout atomic.Int64
+
+// gitTimeout returns how long a git command may run: repo's git_timeout if
+// repo is given and sets one, then the global git_timeout, then the default
+func gitTimeout(repo *Repository) time.Duration {
+	if repo != nil && repo.GitTimeout > 0 {
+		return time.Duration(repo.GitTimeout) * time.Second
+	}
+	if n := globalGitTimeout.Load(); n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return defaultGitTimeout * time.Second
+}
+
+// gitEnv returns the environment for git commands. The daemon has no one
+// to answer a username, password or passphrase prompt.
+func gitEnv() []string {
+	return append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+}
+
+// gitCmd is a git command that is killed, along with children such as ssh,
+// once its timeout expires
+type gitCmd struct {
+	*exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+// newGitCmd prepares git args in dir. Call release once the command is done.
+func newGitCmd(timeout time.Duration, dir string, args ...string) *gitCmd {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitEnv()
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = scriptWaitDelay
+	return &gitCmd{Cmd: cmd, ctx: ctx, cancel: cancel, timeout: timeout}
+}
+
+// release frees the command's timer
+func (c *gitCmd) release() { c.cancel() }
+
+// wrap returns err from running c, replaced by errGitTimeout if c was killed for taking too long
+func (c *gitCmd) wrap(err error) error {
+	if err != nil && errors.Is(c.ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", errGitTimeout, c.timeout)
+	}
+	return err
+}
+
 // ValidateRepository checks if a repository can be accessed
 func ValidateRepository(repo Repository) error {
 	// Ensure the directory exists
@@ -15,18 +79,24 @@ func ValidateRepository(repo Repository) error {
 		return fmt.Errorf("failed to ensure directory exists: %w", err)
 	}
 
+	if err := checkLFSInstalled(repo); err != nil {
+		return err
+	}
+
+	if repo.Strategy == StrategyRelease {
+		return initReleaseLayout(repo)
+	}
+
+	backend := backendFor(repo)
+
 	// Check if it's already a git repository
 	gitDir := filepath.Join(repo.Path, ".git")
 	if fileExists(gitDir) {
 		// Verify it's the correct repository
-		cmd := exec.Command("git", "remote", "get-url", "origin")
-		cmd.Dir = repo.Path
-		output, err := cmd.Output()
+		remoteURL, err := backend.RemoteURL(repo.Path)
 		if err != nil {
 			return fmt.Errorf("failed to get remote URL: %w", err)
 		}
-
-		remoteURL := strings.TrimSpace(string(output))
 		if remoteURL != repo.URL {
 			return fmt.Errorf("directory already contains a different repository: %s", remoteURL)
 		}
@@ -34,15 +104,54 @@ func ValidateRepository(repo Repository) error {
 	}
 
 	// Try to clone the repository
-	cmd := exec.Command("git", "clone", "-b", repo.Branch, repo.URL, repo.Path)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to clone repository: %w\nOutput: %s", err, string(output))
+	if usesMirror(repo) {
+		if err := cloneFromMirror(repo); err != nil {
+			return fmt.Errorf("failed to clone repository from mirror: %w", err)
+		}
+	} else if err := backend.Clone(repo); err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
 	}
 
+	if err := applySparsePaths(repo, repo.Path); err != nil {
+		return err
+	}
+	if err := updateCheckoutExtras(repo, repo.Path); err != nil {
+		return fmt.Errorf("failed to check out submodules or LFS files: %w", err)
+	}
 	return nil
 }
 
+// recordGitTimeout remembers that command timed out for repo, for status to report
+func recordGitTimeout(repo Repository, command string, err error) {
+	UpdateRepoState(repo, func(s *RepoState) {
+		s.Timeout = &TimeoutState{Command: command, Error: err.Error(), At: time.Now()}
+	})
+}
+
+// clearGitTimeout forgets a recorded timeout once repo's remote responds again
+func clearGitTimeout(repo Repository) {
+	if GetRepoState(repo).Timeout != nil {
+		UpdateRepoState(repo, func(s *RepoState) { s.Timeout = nil })
+	}
+}
+
+// runGit runs a git command in dir under the global git timeout and returns
+// its trimmed combined output
+func runGit(dir string, args ...string) (string, error) {
+	return runGitCmd(newGitCmd(gitTimeout(nil), dir, args...), args)
+}
+
+// runGitCmd runs a prepared git command, returning its trimmed combined output
+func runGitCmd(cmd *gitCmd, args []string) (string, error) {
+	defer cmd.release()
+	output, err := cmd.CombinedOutput()
+	out := redactCredentials(strings.TrimSpace(string(output)))
+	if err := cmd.wrap(err); err != nil {
+		return out, fmt.Errorf("git %s failed: %w: %s", args[0], err, out)
+	}
+	return out, nil
+}
+
 // Helper functions
 
 func ensureDirectoryExists(path string) error {
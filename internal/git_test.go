@@ -1,10 +1,12 @@
 package internal
 
 import (
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestValidateRepository(t *testing.T) {
@@ -171,4 +173,45 @@ func TestEnsureDirectoryExists(t *testing.T) {
 			t.Error("Directory with ~ expansion was not created")
 		}
 	})
+}
+func TestGitTimeout(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// A hung SSH connection: the fake ssh and its child never return
+	hung := writeScript(t, "#!/bin/sh\nsleep 60\n")
+	t.Setenv("GIT_SSH_COMMAND", hung)
+
+	repo := Repository{
+		URL:        "git@git.example.com:team/app.git",
+		Branch:     "main",
+		Path:       filepath.Join(t.TempDir(), "app"),
+		GitTimeout: 1,
+	}
+
+	start := time.Now()
+	err := ValidateRepository(repo)
+	if !errors.Is(err, errGitTimeout) {
+		t.Fatalf("Expected clone to time out, got %v", err)
+	}
+	// The whole process tree is killed, so nothing holds the output pipes open
+	if elapsed := time.Since(start); elapsed > scriptWaitDelay {
+		t.Errorf("Clone took %s to time out", elapsed)
+	}
+
+	t.Run("Fetch", func(t *testing.T) {
+		origin := newTestOrigin(t)
+		repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app"), GitTimeout: 1}
+		if err := ValidateRepository(repo); err != nil {
+			t.Fatalf("ValidateRepository failed: %v", err)
+		}
+		gitT(t, repo.Path, "remote", "set-url", "origin", "git@git.example.com:team/app.git")
+		repo.URL = "git@git.example.com:team/app.git"
+
+		NewMonitorV2(&Config{CheckInterval: 60}).checkRepository(repo)
+
+		timeout := GetRepoState(repo).Timeout
+		if timeout == nil || timeout.Command != "ls-remote" {
+			t.Fatalf("Expected ls-remote timeout to be recorded, got %+v", timeout)
+		}
+	})
 }
\ No newline at end of file
@@ -0,0 +1,466 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func init() {
+	// go-git's file transport runs git-upload-pack; serve local remotes
+	// in-process instead so the go-git backend never needs git installed
+	client.InstallProtocol("file", server.NewServer(localLoader{}))
+}
+
+// localLoader opens local repositories, bare or not, for the in-process file transport
+type localLoader struct{}
+
+func (localLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	for _, dir := range []string{filepath.Join(ep.Path, ".git"), ep.Path} {
+		if fileExists(filepath.Join(dir, "HEAD")) {
+			return filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault()), nil
+		}
+	}
+	return nil, transport.ErrRepositoryNotFound
+}
+
+// goGitBackend implements GitBackend with the go-git library
+type goGitBackend struct{}
+
+func (goGitBackend) Clone(repo Repository) error {
+	auth, err := goGitAuth(repo)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout(&repo))
+	defer cancel()
+
+	_, err = git.PlainCloneContext(ctx, repo.Path, false, &git.CloneOptions{
+		URL:           repo.URL,
+		Auth:          auth,
+		ReferenceName: plumbing.NewBranchReferenceName(repo.Branch),
+		SingleBranch:  true,
+	})
+	return goGitTimeout(ctx, repo, err)
+}
+
+func (goGitBackend) RemoteURL(dir string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	remote, err := r.Remote("origin")
+	if err != nil {
+		return "", err
+	}
+	return remote.Config().URLs[0], nil
+}
+
+func (goGitBackend) RemoteChanged(repo Repository, dir string) (bool, error) {
+	r, remote, auth, err := openRemote(repo, dir)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout(&repo))
+	defer cancel()
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return false, goGitTimeout(ctx, repo, err)
+	}
+
+	branch := plumbing.NewBranchReferenceName(repo.Branch)
+	for _, ref := range refs {
+		if ref.Name() != branch {
+			continue
+		}
+		local, err := r.Reference(plumbing.NewRemoteReferenceName("origin", repo.Branch), true)
+		return err != nil || local.Hash() != ref.Hash(), nil
+	}
+	return false, fmt.Errorf("branch %s not found on origin", repo.Branch)
+}
+
+func (goGitBackend) Fetch(repo Repository, dir string) error {
+	_, remote, auth, err := openRemote(repo, dir)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout(&repo))
+	defer cancel()
+
+	refspec := fmt.Sprintf("+refs/heads/%[1]s:refs/remotes/origin/%[1]s", repo.Branch)
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(refspec)},
+		Auth:       auth,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return goGitTimeout(ctx, repo, err)
+}
+
+func (goGitBackend) CurrentBranch(dir string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+	if !head.Name().IsBranch() {
+		return "", nil
+	}
+	return head.Name().Short(), nil
+}
+
+func (goGitBackend) Checkout(dir, branch string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	opts := &git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(branch)}
+	if _, err := r.Reference(opts.Branch, false); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// Like git checkout, start a missing branch from origin's
+		remote, err := r.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+		if err != nil {
+			return fmt.Errorf("branch %s not found: %w", branch, err)
+		}
+		opts.Create = true
+		opts.Hash = remote.Hash()
+	}
+	return w.Checkout(opts)
+}
+
+func (goGitBackend) Resolve(dir, rev string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+	return hash.String(), nil
+}
+
+func (goGitBackend) AheadCount(dir, base, rev string) (int, error) {
+	count := 0
+	err := walkIncoming(dir, base, rev, func(*object.Commit) { count++ })
+	return count, err
+}
+
+func (goGitBackend) CommitMessages(dir, base, rev string) ([]string, error) {
+	var messages []string
+	err := walkIncoming(dir, base, rev, func(c *object.Commit) { messages = append(messages, c.Message) })
+	return messages, err
+}
+
+// walkIncoming calls fn for each commit reachable from rev but not from
+// base, as in git rev-list base..rev
+func walkIncoming(dir, base, rev string, fn func(*object.Commit)) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	baseCommit, err := resolveCommit(r, base)
+	if err != nil {
+		return err
+	}
+	revCommit, err := resolveCommit(r, rev)
+	if err != nil {
+		return err
+	}
+
+	seen := map[plumbing.Hash]bool{}
+	err = object.NewCommitPreorderIter(baseCommit, nil, nil).ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return object.NewCommitPreorderIter(revCommit, seen, nil).ForEach(func(c *object.Commit) error {
+		fn(c)
+		return nil
+	})
+}
+
+func (goGitBackend) HasLocalChanges(dir string) (bool, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return false, err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return false, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return false, err
+	}
+	for _, file := range status {
+		if file.Worktree == git.Untracked {
+			continue
+		}
+		if file.Staging != git.Unmodified || file.Worktree != git.Unmodified {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (goGitBackend) ChangedFiles(dir, from, to string) ([]string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	var trees [2]*object.Tree
+	for i, rev := range []string{from, to} {
+		commit, err := resolveCommit(r, rev)
+		if err != nil {
+			return nil, err
+		}
+		if trees[i], err = commit.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTree(trees[0], trees[1])
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	seen := map[string]bool{}
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				files = append(files, name)
+			}
+		}
+	}
+	return files, nil
+}
+
+func (goGitBackend) FastForward(dir, target string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	head, err := resolveCommit(r, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	next, err := resolveCommit(r, target)
+	if err != nil {
+		return "", err
+	}
+	// Like git merge, a target HEAD already contains needs nothing
+	if merged, err := next.IsAncestor(head); err != nil || merged || head.Hash == next.Hash {
+		return "Already up to date.", err
+	}
+
+	ok, err := head.IsAncestor(next)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: HEAD is not an ancestor of %s", git.ErrNonFastForwardUpdate, target)
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return "", err
+	}
+	// A merge reset keeps the working tree's untracked files and refuses to
+	// overwrite local modifications
+	if err := w.Reset(&git.ResetOptions{Commit: next.Hash, Mode: git.MergeReset}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Updating %s..%s\nFast-forward", shortSHA(head.Hash.String()), shortSHA(next.Hash.String())), nil
+}
+
+// resolveCommit returns the commit rev points at in r
+func resolveCommit(r *git.Repository, rev string) (*object.Commit, error) {
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+	return r.CommitObject(*hash)
+}
+
+// openRemote opens dir and its origin remote along with repo's credentials
+func openRemote(repo Repository, dir string) (*git.Repository, *git.Remote, transport.AuthMethod, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	remote, err := r.Remote("origin")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	auth, err := goGitAuth(repo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return r, remote, auth, nil
+}
+
+// goGitTimeout replaces err with errGitTimeout if ctx expired, matching gitCmd.wrap
+func goGitTimeout(ctx context.Context, repo Repository, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", errGitTimeout, gitTimeout(&repo))
+	}
+	return err
+}
+
+// goGitAuth returns the credentials for repo's remote: the HTTPS token
+// from remoteCredentials, or the SSH key and host key settings that
+// sshCommand passes to ssh for the exec backend
+func goGitAuth(repo Repository) (transport.AuthMethod, error) {
+	transportName, err := RemoteTransport(repo.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch transportName {
+	case TransportHTTPS:
+		user, token, err := remoteCredentials(repo)
+		if err != nil || token == "" {
+			return nil, err
+		}
+		return &githttp.BasicAuth{Username: user, Password: token}, nil
+	case TransportSSH:
+		return goGitSSHAuth(repo)
+	}
+	return nil, nil
+}
+
+// goGitSSHAuth authenticates with repo's ssh_key, else the SSH agent, else
+// the first of the usual keys in ~/.ssh
+func goGitSSHAuth(repo Repository) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(repo.URL)
+	if err != nil {
+		return nil, err
+	}
+	username := ep.User
+	if username == "" {
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+	}
+
+	hostKeys, err := goGitHostKeyCallback(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	key := expandHome(repo.SSHKey)
+	if key == "" && os.Getenv("SSH_AUTH_SOCK") != "" {
+		auth, err := gitssh.NewSSHAgentAuth(username)
+		if err != nil {
+			return nil, err
+		}
+		auth.HostKeyCallback = hostKeys
+		return auth, nil
+	}
+	if key == "" {
+		home, _ := os.UserHomeDir()
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			if path := filepath.Join(home, ".ssh", name); fileExists(path) {
+				key = path
+				break
+			}
+		}
+	}
+	if key == "" {
+		return nil, errors.New("no SSH key found: set ssh_key or start an SSH agent")
+	}
+
+	auth, err := gitssh.NewPublicKeysFromFile(username, key, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", key, err)
+	}
+	auth.HostKeyCallback = hostKeys
+	return auth, nil
+}
+
+// goGitHostKeyCallback verifies host keys against repo's known_hosts file,
+// or the default ones, following strict_host_key_checking
+func goGitHostKeyCallback(repo Repository) (ssh.HostKeyCallback, error) {
+	var files []string
+	if repo.KnownHosts != "" {
+		files = []string{expandHome(repo.KnownHosts)}
+	}
+
+	switch repo.StrictHostKeyChecking {
+	case "no":
+		return ssh.InsecureIgnoreHostKey(), nil
+	case "accept-new":
+		if len(files) > 0 {
+			return acceptNewHostKey(files[0]), nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		return acceptNewHostKey(filepath.Join(home, ".ssh", "known_hosts")), nil
+	}
+	return gitssh.NewKnownHostsCallback(files...)
+}
+
+// acceptNewHostKey trusts and records the key of a host missing from file,
+// like ssh's StrictHostKeyChecking=accept-new, but rejects a changed key
+func acceptNewHostKey(file string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if fileExists(file) {
+			check, err := knownhosts.New(file)
+			if err != nil {
+				return err
+			}
+			err = check(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+				return err
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}
+}
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DeployKindDeploy is a deployment triggered by new commits
+	DeployKindDeploy = "deploy"
+	// DeployKindRollback is a deployment triggered by spdeploy rollback
+	DeployKindRollback = "rollback"
+	// DeployKindRetry re-runs a failed post-pull script without new commits
+	DeployKindRetry = "retry"
+
+	DeployStatusSuccess = "success"
+	DeployStatusFailed  = "failed"
+	// DeployStatusVetoed means a pre_deploy hook refused the update
+	DeployStatusVetoed = "vetoed"
+	// DeployStatusInterrupted means the daemon shut down before the deployment finished
+	DeployStatusInterrupted = "interrupted"
+	// DeployStatusConflict means local changes or diverged history blocked the update
+	DeployStatusConflict = "conflict"
+	// DeployStatusTimedOut means a git command or the post-pull script was killed for running too long
+	DeployStatusTimedOut = "timed_out"
+	// DeployStatusSkipped means no watched path changed, so the working copy
+	// was updated without running hooks or the post-pull script
+	DeployStatusSkipped = "skipped"
+	// DeployStatusRejected means require_signed refused a commit without a valid signature
+	DeployStatusRejected = "rejected"
+)
+
+// Deployment is one recorded deploy attempt
+type Deployment struct {
+	ID             string    `json:"id"`
+	Kind           string    `json:"kind"`
+	Repo           string    `json:"repo"`
+	Path           string    `json:"path"`
+	Branch         string    `json:"branch"`
+	Tag            string    `json:"tag,omitempty"`
+	OldSHA         string    `json:"old_sha"`
+	NewSHA         string    `json:"new_sha"`
+	CommitCount    int       `json:"commit_count"`
+	PullOutput     string    `json:"pull_output,omitempty"`
+	Paths          []string  `json:"paths,omitempty"`
+	Directive      string    `json:"directive,omitempty"`
+	Backup         string    `json:"backup,omitempty"`
+	ScriptExitCode *int      `json:"script_exit_code,omitempty"`
+	Status         string    `json:"status"`
+	Error          string    `json:"error,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	DurationMS     int64     `json:"duration_ms"`
+
+	// dir is the checkout being deployed when it isn't the deploy path,
+	// i.e. a new release; hooks run there
+	dir string
+}
+
+// HistoryFilter narrows down LoadHistory results
+type HistoryFilter struct {
+	// Repo matches a repository URL or deploy path; empty matches everything
+	Repo string
+	// Limit caps the number of results; zero means no limit
+	Limit int
+}
+
+// historyMu serialises appends to the history file within a process
+var historyMu sync.Mutex
+
+func getHistoryPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".spdeploy", "history.jsonl")
+}
+
+// newDeployment starts a deployment record for repo
+func newDeployment(repo Repository, kind string) *Deployment {
+	return &Deployment{
+		ID:        newDeployID(),
+		Kind:      kind,
+		Repo:      repo.URL,
+		Path:      stateKey(repo),
+		Branch:    repo.Branch,
+		StartedAt: time.Now(),
+	}
+}
+
+// newDeployID returns a sortable, unique identifier for a deployment
+func newDeployID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(b))
+}
+
+// setScriptResult records the post-pull script's exit code from its error
+func (d *Deployment) setScriptResult(err error) {
+	code := 0
+	if err != nil {
+		code = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		}
+	}
+	d.ScriptExitCode = &code
+}
+
+// finish marks the deployment as done and records the outcome
+func (d *Deployment) finish(err error) {
+	d.FinishedAt = time.Now()
+	d.DurationMS = d.FinishedAt.Sub(d.StartedAt).Milliseconds()
+	if err != nil {
+		d.Status = DeployStatusFailed
+		switch {
+		case errors.Is(err, errInterrupted):
+			d.Status = DeployStatusInterrupted
+		case errors.Is(err, errConflict):
+			d.Status = DeployStatusConflict
+		case errors.Is(err, errUnverified):
+			d.Status = DeployStatusRejected
+		case errors.Is(err, errGitTimeout), errors.Is(err, errScriptTimeout):
+			d.Status = DeployStatusTimedOut
+		}
+		d.Error = err.Error()
+	} else {
+		d.Status = DeployStatusSuccess
+	}
+}
+
+// skip marks an update that touched no watched paths as applied without
+// running hooks or the post-pull script
+func (d *Deployment) skip() {
+	d.finish(nil)
+	d.Status = DeployStatusSkipped
+}
+
+// veto marks the deployment as refused by a pre_deploy hook
+func (d *Deployment) veto(err error) {
+	d.finish(err)
+	if d.Status != DeployStatusInterrupted {
+		d.Status = DeployStatusVetoed
+	}
+}
+
+// marker returns the state file reference to d
+func (d *Deployment) marker() *DeployMarker {
+	return &DeployMarker{
+		ID:        d.ID,
+		Kind:      d.Kind,
+		OldSHA:    d.OldSHA,
+		NewSHA:    d.NewSHA,
+		StartedAt: d.StartedAt,
+	}
+}
+
+// RecordDeployment appends a deployment to the history file
+func RecordDeployment(d *Deployment) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	historyPath := getHistoryPath()
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment: %w", err)
+	}
+
+	f, err := os.OpenFile(historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// LoadHistory returns recorded deployments matching filter, newest first
+func LoadHistory(filter HistoryFilter) ([]Deployment, error) {
+	f, err := os.Open(getHistoryPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var absFilter string
+	if filter.Repo != "" {
+		absFilter, _ = filepath.Abs(filter.Repo)
+	}
+
+	var deployments []Deployment
+	scanner := bufio.NewScanner(f)
+	// Pull and script output can make individual records large
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var d Deployment
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			// Skip a torn or corrupt line rather than losing the whole history
+			continue
+		}
+		if filter.Repo != "" && d.Path != absFilter && repoKey(d.Repo) != repoKey(filter.Repo) {
+			continue
+		}
+		deployments = append(deployments, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	// The file is in chronological order; callers want the newest first
+	for i, j := 0, len(deployments)-1; i < j; i, j = i+1, j-1 {
+		deployments[i], deployments[j] = deployments[j], deployments[i]
+	}
+
+	if filter.Limit > 0 && len(deployments) > filter.Limit {
+		deployments = deployments[:filter.Limit]
+	}
+	return deployments, nil
+}
+
+// countCommits returns the number of commits in old..new within repo's git
+// directory dir, or 0 if it can't be determined
+func countCommits(repo Repository, dir, oldSHA, newSHA string) int {
+	if oldSHA == "" || newSHA == "" {
+		return 0
+	}
+	n, err := backendFor(repo).AheadCount(dir, oldSHA, newSHA)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeploymentHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	prod := Repository{URL: "git@github.com:app/site.git", Branch: "main", Path: "/var/www/prod"}
+	api := Repository{URL: "git@github.com:app/api.git", Branch: "main", Path: "/opt/api"}
+
+	for i, repo := range []Repository{prod, api, prod} {
+		d := newDeployment(repo, DeployKindDeploy)
+		d.NewSHA = string(rune('a' + i))
+		d.finish(nil)
+		if err := RecordDeployment(d); err != nil {
+			t.Fatalf("RecordDeployment failed: %v", err)
+		}
+	}
+
+	all, err := LoadHistory(HistoryFilter{})
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 deployments, got %d", len(all))
+	}
+	if all[0].NewSHA != "c" {
+		t.Errorf("Expected newest deployment first, got %s", all[0].NewSHA)
+	}
+
+	byPath, _ := LoadHistory(HistoryFilter{Repo: "/var/www/prod"})
+	if len(byPath) != 2 {
+		t.Errorf("Expected 2 deployments for prod path, got %d", len(byPath))
+	}
+
+	byURL, _ := LoadHistory(HistoryFilter{Repo: "https://github.com/app/api"})
+	if len(byURL) != 1 {
+		t.Errorf("Expected 1 deployment for api URL, got %d", len(byURL))
+	}
+
+	limited, _ := LoadHistory(HistoryFilter{Limit: 1})
+	if len(limited) != 1 {
+		t.Errorf("Expected limit to apply, got %d", len(limited))
+	}
+}
+
+func TestDeploymentScriptResult(t *testing.T) {
+	d := newDeployment(Repository{Path: "/srv/app"}, DeployKindDeploy)
+
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	d.setScriptResult(exitErr)
+	if d.ScriptExitCode == nil || *d.ScriptExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %v", d.ScriptExitCode)
+	}
+
+	d.setScriptResult(errors.New("script not found"))
+	if *d.ScriptExitCode != -1 {
+		t.Errorf("Expected exit code -1 for non-exit errors, got %d", *d.ScriptExitCode)
+	}
+
+	d.finish(exitErr)
+	if d.Status != DeployStatusFailed || d.Error == "" {
+		t.Errorf("Expected failed status with error, got %+v", d)
+	}
+}
+
+func TestCheckRepositoryRecordsHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app")}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	oldSHA := gitT(t, repo.Path, "rev-parse", "HEAD")
+	commitFile(t, origin, "a.txt", "a")
+	newSHA := commitFile(t, origin, "b.txt", "b")
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.checkRepository(repo)
+
+	history, err := LoadHistory(HistoryFilter{Repo: repo.Path})
+	if err != nil || len(history) != 1 {
+		t.Fatalf("Expected 1 recorded deployment, got %d (%v)", len(history), err)
+	}
+	d := history[0]
+	if d.OldSHA != oldSHA || d.NewSHA != newSHA || d.CommitCount != 2 || d.Status != DeployStatusSuccess {
+		t.Errorf("Unexpected deployment record: %+v", d)
+	}
+	if d.ScriptExitCode != nil {
+		t.Error("Expected no script exit code without a post-pull script")
+	}
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"fmt"
+	"os/exec"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// Hook stages, in the order they run during a check
+const (
+	HookPreFetch   = "pre_fetch"
+	HookPreDeploy  = "pre_deploy"
+	HookPostDeploy = "post_deploy"
+	HookOnSuccess  = "on_success"
+	HookOnFailure  = "on_failure"
+)
+
+// HookStages lists every supported hook stage
+var HookStages = []string{HookPreFetch, HookPreDeploy, HookPostDeploy, HookOnSuccess, HookOnFailure}
+
+// Hooks holds the shell commands to run at each deploy stage. Commands run
+// with /bin/sh -c from the checkout (see hookDir) and receive the same
+// SPDEPLOY_* environment as the post-pull script.
+type Hooks struct {
+	// PreFetch runs before every fetch; a failure skips the check
+	PreFetch []string `json:"pre_fetch,omitempty"`
+	// PreDeploy runs once new commits are found; a failure vetoes the update
+	PreDeploy []string `json:"pre_deploy,omitempty"`
+	// PostDeploy runs after the update and post-pull script succeed
+	PostDeploy []string `json:"post_deploy,omitempty"`
+	// OnSuccess runs after a deployment completes successfully
+	OnSuccess []string `json:"on_success,omitempty"`
+	// OnFailure runs when the update, post-pull script or post_deploy hook
+	// fails, and when a check fails outright, e.g. because the fetch did
+	OnFailure []string `json:"on_failure,omitempty"`
+}
+
+// Commands returns the commands configured for stage
+func (h *Hooks) Commands(stage string) []string {
+	if h == nil {
+		return nil
+	}
+	switch stage {
+	case HookPreFetch:
+		return h.PreFetch
+	case HookPreDeploy:
+		return h.PreDeploy
+	case HookPostDeploy:
+		return h.PostDeploy
+	case HookOnSuccess:
+		return h.OnSuccess
+	case HookOnFailure:
+		return h.OnFailure
+	}
+	return nil
+}
+
+// Add appends a command to stage
+func (h *Hooks) Add(stage, command string) error {
+	switch stage {
+	case HookPreFetch:
+		h.PreFetch = append(h.PreFetch, command)
+	case HookPreDeploy:
+		h.PreDeploy = append(h.PreDeploy, command)
+	case HookPostDeploy:
+		h.PostDeploy = append(h.PostDeploy, command)
+	case HookOnSuccess:
+		h.OnSuccess = append(h.OnSuccess, command)
+	case HookOnFailure:
+		h.OnFailure = append(h.OnFailure, command)
+	default:
+		return fmt.Errorf("unknown hook stage %q", stage)
+	}
+	return nil
+}
+
+// runHooks runs the commands for stage in order, stopping at the first failure.
+// deploy may be nil for stages that run outside a deployment. extraEnv is
+// appended to the hook environment.
+func (m *MonitorV2) runHooks(repo Repository, stage string, deploy *Deployment, repoLogger *logger.RepoLogger, extraEnv ...string) error {
+	for i, command := range repo.Hooks.Commands(stage) {
+		ctx, cancel := scriptContext(m.scriptCtx, repo.ScriptTimeout)
+
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+		cmd.Dir = hookDir(repo, deploy)
+		cmd.Env = append(scriptEnv(repo, deploy), "SPDEPLOY_HOOK="+stage)
+		cmd.Env = append(cmd.Env, extraEnv...)
+
+		logInfo(repoLogger, repo, "Running hook",
+			zap.String("stage", stage),
+			zap.String("command", command))
+
+		tail, err := runScript(cmd, func(stream, line string) {
+			if repoLogger != nil {
+				repoLogger.Info("Hook output",
+					zap.String("stage", stage),
+					zap.String("stream", stream),
+					zap.String("line", line))
+			} else {
+				logger.Info("Hook output",
+					zap.String("repo", repo.URL),
+					zap.String("stage", stage),
+					zap.String("stream", stream),
+					zap.String("line", line))
+			}
+		})
+		err = scriptError(ctx, repo.ScriptTimeout, err)
+		cancel()
+
+		if err != nil {
+			logError(repoLogger, repo, "Hook failed",
+				zap.String("stage", stage),
+				zap.Int("index", i),
+				zap.String("command", command),
+				zap.Error(err),
+				zap.String("output_tail", tail))
+			return fmt.Errorf("%s hook %q failed: %w", stage, command, err)
+		}
+	}
+	return nil
+}
+
+// hookDir returns the directory hooks run in: the release being deployed,
+// the live release for the release strategy, or else the deploy path. If
+// the deploy path is missing, on_failure hooks still run, from the
+// daemon's working directory.
+func hookDir(repo Repository, deploy *Deployment) string {
+	if deploy != nil && deploy.dir != "" && fileExists(deploy.dir) {
+		return deploy.dir
+	}
+	if repo.Strategy == StrategyRelease && fileExists(currentLink(repo)) {
+		return currentLink(repo)
+	}
+	if !fileExists(repo.Path) {
+		return ""
+	}
+	return repo.Path
+}
+
+// finishDeployment runs the post_deploy hooks after a successful update, then
+// on_success or on_failure depending on the outcome, and completes the record
+func (m *MonitorV2) finishDeployment(repo Repository, deploy *Deployment, err error, repoLogger *logger.RepoLogger) {
+	if err == nil {
+		err = m.runHooks(repo, HookPostDeploy, deploy, repoLogger)
+	}
+
+	deploy.finish(err)
+	trackScriptResult(repo, deploy, repoLogger)
+
+	// Failures of these hooks are logged by runHooks but don't change the outcome
+	if err != nil {
+		m.runHooks(repo, HookOnFailure, deploy, repoLogger, "SPDEPLOY_ERROR="+err.Error())
+		return
+	}
+	m.runHooks(repo, HookOnSuccess, deploy, repoLogger)
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHooksAdd(t *testing.T) {
+	hooks := &Hooks{}
+	for _, stage := range HookStages {
+		if err := hooks.Add(stage, "echo "+stage); err != nil {
+			t.Errorf("Add(%s) failed: %v", stage, err)
+		}
+		if cmds := hooks.Commands(stage); len(cmds) != 1 || cmds[0] != "echo "+stage {
+			t.Errorf("Commands(%s) = %v", stage, cmds)
+		}
+	}
+
+	if err := hooks.Add("after_lunch", "true"); err == nil {
+		t.Error("Expected error for unknown stage")
+	}
+
+	var none *Hooks
+	if cmds := none.Commands(HookPreFetch); cmds != nil {
+		t.Error("Expected nil hooks to have no commands")
+	}
+}
+
+func TestDeployHooks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	commitFile(t, origin, "deploy.sh", "#!/bin/sh\nexit 0\n")
+
+	markers := t.TempDir()
+	marker := func(name string) string { return filepath.Join(markers, name) }
+	veto := marker("veto")
+
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "app"),
+		PostPullScript: "deploy.sh",
+		Hooks: &Hooks{
+			PreFetch:   []string{"touch " + marker("pre_fetch")},
+			PreDeploy:  []string{"test ! -f " + veto},
+			PostDeploy: []string{"echo $SPDEPLOY_NEW_SHA > " + marker("post_deploy")},
+			OnSuccess:  []string{"touch " + marker("on_success")},
+			OnFailure:  []string{"echo \"$SPDEPLOY_ERROR\" > " + marker("on_failure")},
+		},
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	t.Run("PreDeployVeto", func(t *testing.T) {
+		before := gitT(t, repo.Path, "rev-parse", "HEAD")
+		commitFile(t, origin, "a.txt", "a")
+		os.WriteFile(veto, nil, 0644)
+		defer os.Remove(veto)
+
+		monitor.checkRepository(repo)
+
+		if !fileExists(marker("pre_fetch")) {
+			t.Error("pre_fetch hook did not run")
+		}
+		if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != before {
+			t.Error("Vetoed deployment still pulled changes")
+		}
+		history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+		if len(history) != 1 || history[0].Status != DeployStatusVetoed {
+			t.Errorf("Expected vetoed deployment in history, got %+v", history)
+		}
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		monitor.checkRepository(repo)
+
+		head := gitT(t, repo.Path, "rev-parse", "HEAD")
+		data, err := os.ReadFile(marker("post_deploy"))
+		if err != nil || strings.TrimSpace(string(data)) != head {
+			t.Errorf("post_deploy hook did not see the new SHA: %q (%v)", data, err)
+		}
+		if !fileExists(marker("on_success")) {
+			t.Error("on_success hook did not run")
+		}
+		if fileExists(marker("on_failure")) {
+			t.Error("on_failure hook ran for a successful deployment")
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		os.Remove(marker("on_success"))
+		commitFile(t, origin, "deploy.sh", "#!/bin/sh\nexit 2\n")
+
+		monitor.checkRepository(repo)
+
+		data, err := os.ReadFile(marker("on_failure"))
+		if err != nil || !strings.Contains(string(data), "post-pull script failed") {
+			t.Errorf("on_failure hook did not receive the error: %q (%v)", data, err)
+		}
+		if fileExists(marker("on_success")) {
+			t.Error("on_success hook ran for a failed deployment")
+		}
+	})
+}
+
+func TestReleaseHooksRunInRelease(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	markers := t.TempDir()
+	repo := Repository{
+		URL:      origin,
+		Branch:   "main",
+		Path:     filepath.Join(t.TempDir(), "site"),
+		Strategy: StrategyRelease,
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.checkRepository(repo)
+
+	// Both hooks see the checkout of the commit being deployed
+	repo.Hooks = &Hooks{
+		PreDeploy:  []string{"cat new.txt > " + filepath.Join(markers, "pre_deploy")},
+		PostDeploy: []string{"cat new.txt > " + filepath.Join(markers, "post_deploy")},
+	}
+	commitFile(t, origin, "new.txt", "v2")
+	monitor.checkRepository(repo)
+
+	for _, stage := range []string{"pre_deploy", "post_deploy"} {
+		if data, _ := os.ReadFile(filepath.Join(markers, stage)); string(data) != "v2" {
+			t.Errorf("Expected the %s hook to run in the new release, got %q", stage, data)
+		}
+	}
+}
+
+func TestOnFailureForFailedCheck(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	marker := filepath.Join(t.TempDir(), "on_failure")
+	repo := Repository{
+		URL:    origin,
+		Branch: "main",
+		Path:   filepath.Join(t.TempDir(), "app"),
+		Hooks:  &Hooks{OnFailure: []string{"echo \"$SPDEPLOY_ERROR\" | head -n 1 >> " + marker}},
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	// The remote goes away, so every fetch fails
+	if err := os.RemoveAll(origin); err != nil {
+		t.Fatal(err)
+	}
+	monitor.checkRepository(repo)
+	monitor.checkRepository(repo)
+
+	data, _ := os.ReadFile(marker)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "fetch") {
+		t.Errorf("Expected on_failure once for the failed fetch, got %q", data)
+	}
+}
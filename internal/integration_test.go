@@ -131,6 +131,7 @@ func TestIntegrationFullWorkflow(t *testing.T) {
 		case <-time.After(1 * time.Second):
 			t.Error("Monitor initialization timed out")
 		}
+		monitor.Shutdown()
 	})
 
 	t.Run("LoggerIntegration", func(t *testing.T) {
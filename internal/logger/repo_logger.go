@@ -85,6 +85,8 @@ func NewRepoLogger(repoURL, repoPath string) (*RepoLogger, error) {
 	zapConfig := zap.NewProductionConfig()
 	zapConfig.OutputPaths = []string{logFile}
 	zapConfig.ErrorOutputPaths = []string{logFile}
+	// Script output is logged line by line; sampling would drop lines from busy builds
+	zapConfig.Sampling = nil
 
 	// Add user and repo context to all logs
 	zapConfig.InitialFields = map[string]interface{}{
@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// globalSharedMirrors is the config's shared_mirrors, updated with globalGitTimeout
+var globalSharedMirrors atomic.Bool
+
+// mirrorState tracks one mirror within this process
+type mirrorState struct {
+	mu sync.Mutex
+	// fetched is when the remote was last asked for its refs
+	fetched time.Time
+}
+
+var (
+	mirrorsMu sync.Mutex
+	mirrors   = map[string]*mirrorState{}
+	// mirrorChecks is when each deploy path last refreshed its mirror
+	mirrorChecks = map[string]time.Time{}
+)
+
+var unsafeMirrorChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func getMirrorsDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".spdeploy", "mirrors")
+}
+
+// usesMirror reports whether repo is updated from a shared mirror rather
+// than fetching its remote itself. Release deployments keep their own bare
+// repository, and go-git checkouts can't borrow objects from one.
+func usesMirror(repo Repository) bool {
+	return globalSharedMirrors.Load() && repo.Strategy != StrategyRelease && usesExec(repo)
+}
+
+// MirrorPath returns the shared mirror repo is updated from, or "" when it
+// fetches from its remote itself
+func MirrorPath(repo Repository) string {
+	if !usesMirror(repo) {
+		return ""
+	}
+	return mirrorDir(repo.URL)
+}
+
+// mirrorDir returns the bare mirror for url, named after the URL and a hash of it
+func mirrorDir(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	name := strings.Trim(unsafeMirrorChars.ReplaceAllString(url, "-"), "-.")
+	if len(name) > 60 {
+		name = name[len(name)-60:]
+	}
+	return filepath.Join(getMirrorsDir(), fmt.Sprintf("%s-%x.git", name, sum[:4]))
+}
+
+func getMirror(dir string) *mirrorState {
+	mirrorsMu.Lock()
+	defer mirrorsMu.Unlock()
+	m, ok := mirrors[dir]
+	if !ok {
+		m = &mirrorState{}
+		mirrors[dir] = m
+	}
+	return m
+}
+
+// expireMirror makes the next check of a repository using url's mirror ask
+// the remote again, e.g. because a webhook reported a push
+func expireMirror(url string) {
+	m := getMirror(mirrorDir(url))
+	m.mu.Lock()
+	m.fetched = time.Time{}
+	m.mu.Unlock()
+}
+
+// initMirror creates the bare mirror dir for repo's URL if it doesn't
+// exist; the caller holds the mirror's lock. It holds every branch and tag,
+// and never prunes objects, since deploy paths borrow them through alternates.
+func initMirror(repo Repository, dir string) error {
+	if fileExists(filepath.Join(dir, "HEAD")) {
+		return nil
+	}
+	if err := os.MkdirAll(getMirrorsDir(), 0755); err != nil {
+		return err
+	}
+	// Only clean up after a failure if the directory is ours to remove
+	_, err := os.Stat(dir)
+	created := os.IsNotExist(err)
+
+	steps := [][]string{
+		{"init", "--bare", "--quiet", dir},
+		{"-C", dir, "remote", "add", "origin", repo.URL},
+		{"-C", dir, "config", "--replace-all", "remote.origin.fetch", "+refs/heads/*:refs/heads/*"},
+		{"-C", dir, "config", "--add", "remote.origin.fetch", "+refs/tags/*:refs/tags/*"},
+		{"-C", dir, "config", "gc.pruneExpire", "never"},
+	}
+	for _, args := range steps {
+		if _, err := runGit("", args...); err != nil {
+			if created {
+				os.RemoveAll(dir)
+			}
+			return fmt.Errorf("failed to create mirror %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// refreshMirror brings the mirror of repo's URL up to date and returns its
+// path and the last git command run against the remote. Deploy paths of
+// the same URL share one round trip per poll cycle: the remote is only
+// asked again once repo has been checked since the last time it was.
+func refreshMirror(repo Repository) (dir, command string, err error) {
+	dir = mirrorDir(repo.URL)
+	m := getMirror(dir)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := initMirror(repo, dir); err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	mirrorsMu.Lock()
+	prev, seen := mirrorChecks[repo.Path]
+	mirrorChecks[repo.Path] = now
+	mirrorsMu.Unlock()
+	if !m.fetched.IsZero() && (!seen || m.fetched.After(prev)) {
+		return dir, "", nil
+	}
+
+	command = "ls-remote"
+	output, err := runRemoteGit(repo, dir, "ls-remote", "--heads", "--tags", "--refs", "origin")
+	if err != nil {
+		return dir, command, err
+	}
+	local, err := runGit(dir, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return dir, command, err
+	}
+	if !maps.Equal(parseRefs(output), parseRefs(local)) {
+		command = "fetch"
+		if _, err := runRemoteGit(repo, dir, "fetch", "--prune", "--quiet", "origin"); err != nil {
+			return dir, command, err
+		}
+	}
+	m.fetched = now
+	return dir, command, nil
+}
+
+// fetchFromMirror refreshes repo's mirror and then updates dir's copies of
+// the refs repo deploys from it, which never leaves the machine
+func fetchFromMirror(repo Repository, dir string) (string, error) {
+	mirror, command, err := refreshMirror(repo)
+	if err != nil {
+		return command, err
+	}
+	if err := addAlternate(dir, mirror); err != nil {
+		return command, err
+	}
+
+	args := fetchArgs(repo)
+	for i, arg := range args {
+		if arg == "origin" {
+			args[i] = mirror
+		}
+	}
+	_, err = runGit(dir, args...)
+	return "fetch", err
+}
+
+// addAlternate lets the checkout in dir borrow objects from mirror, so a
+// checkout cloned before shared mirrors were enabled stops storing its own
+// copy of new objects
+func addAlternate(dir, mirror string) error {
+	objects := filepath.Join(mirror, "objects")
+	alternates := filepath.Join(dir, ".git", "objects", "info", "alternates")
+	data, err := os.ReadFile(alternates)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == objects {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(alternates), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(alternates, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		objects = "\n" + objects
+	}
+	_, err = fmt.Fprintln(f, objects)
+	return err
+}
+
+// cloneFromMirror clones repo from its mirror, sharing the mirror's
+// objects, and then points origin back at repo.URL
+func cloneFromMirror(repo Repository) error {
+	mirror, _, err := refreshMirror(repo)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"clone", "--quiet", "--shared", "-b", repo.Branch, mirror, repo.Path}
+	if repo.Tag != "" {
+		args = []string{"clone", "--quiet", "--shared", mirror, repo.Path}
+	}
+	if len(repo.SparsePaths) > 0 {
+		args = withArgs(args, "--sparse")
+	}
+	if _, err := runGit("", args...); err != nil {
+		return err
+	}
+	_, err = runGit(repo.Path, "remote", "set-url", "origin", repo.URL)
+	return err
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSharedMirror(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	gitT(t, origin, "branch", "staging")
+
+	config := &Config{CheckInterval: 60, SharedMirrors: true}
+	prod := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "prod")}
+	staging := Repository{URL: origin, Branch: "staging", Path: filepath.Join(t.TempDir(), "staging")}
+	config.Repositories = []Repository{prod, staging}
+	monitor := NewMonitorV2(config)
+	t.Cleanup(func() { setGitDefaults(&Config{}) })
+
+	for _, repo := range config.Repositories {
+		if err := ValidateRepository(repo); err != nil {
+			t.Fatalf("ValidateRepository failed: %v", err)
+		}
+		if url := gitT(t, repo.Path, "remote", "get-url", "origin"); url != origin {
+			t.Errorf("Expected origin %s, got %s", origin, url)
+		}
+		alternates, _ := os.ReadFile(filepath.Join(repo.Path, ".git", "objects", "info", "alternates"))
+		if !strings.Contains(string(alternates), mirrorDir(origin)) {
+			t.Errorf("Expected %s to borrow objects from the mirror, got alternates %q", repo.Path, alternates)
+		}
+	}
+
+	mainHead := commitFile(t, origin, "index.html", "v2")
+	gitT(t, origin, "checkout", "-q", "staging")
+	stagingHead := commitFile(t, origin, "index.html", "staging")
+	gitT(t, origin, "checkout", "-q", "main")
+
+	// As after a webhook, or a restart: the next check asks the remote
+	expireMirror(origin)
+	monitor.checkRepository(prod)
+	if head := gitT(t, prod.Path, "rev-parse", "HEAD"); head != mainHead {
+		t.Fatalf("Expected prod at %s, got %s", mainHead, head)
+	}
+
+	// Staging reuses that fetch, so it deploys without reaching the remote
+	moved := origin + ".moved"
+	if err := os.Rename(origin, moved); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Rename(moved, origin)
+	monitor.checkRepository(staging)
+	if head := gitT(t, staging.Path, "rev-parse", "HEAD"); head != stagingHead {
+		t.Errorf("Expected staging at %s from the mirror, got %s", stagingHead, head)
+	}
+	if failures := GetRepoState(staging).Failures; failures != nil {
+		t.Errorf("Expected staging's check to succeed, got %+v", failures)
+	}
+
+	// Prod's next cycle asks the remote again
+	monitor.checkRepository(prod)
+	if failures := GetRepoState(prod).Failures; failures == nil {
+		t.Error("Expected prod's next check to contact the remote")
+	}
+}
+
+func TestAddAlternate(t *testing.T) {
+	dir := t.TempDir()
+	alternates := filepath.Join(dir, ".git", "objects", "info", "alternates")
+	os.MkdirAll(filepath.Dir(alternates), 0755)
+	os.WriteFile(alternates, []byte("/srv/other/objects"), 0644)
+
+	for i := 0; i < 2; i++ {
+		if err := addAlternate(dir, "/srv/mirror.git"); err != nil {
+			t.Fatalf("addAlternate failed: %v", err)
+		}
+	}
+	data, _ := os.ReadFile(alternates)
+	want := "/srv/other/objects\n" + filepath.Join("/srv/mirror.git", "objects") + "\n"
+	if string(data) != want {
+		t.Errorf("alternates = %q, want %q", data, want)
+	}
+}
+
+func TestInitMirrorKeepsExistingPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	repo := Repository{URL: "https://example.com/app.git"}
+	dir := mirrorDir(repo.URL)
+	os.MkdirAll(filepath.Dir(dir), 0755)
+	os.WriteFile(dir, []byte("not a mirror"), 0644)
+
+	if err := initMirror(repo, dir); err == nil {
+		t.Fatal("Expected initMirror to fail over a regular file")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("initMirror removed a path it didn't create: %v", err)
+	}
+}
@@ -1,10 +1,12 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
+	"net/http"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"spdeploy/internal/logger"
@@ -13,7 +15,44 @@ import (
 
 // MonitorV2 is an improved monitor that uses repo-specific logging
 type MonitorV2 struct {
-	config *Config
+	// config is replaced as a whole on reload; read it through currentConfig
+	configMu sync.RWMutex
+	config   *Config
+
+	// workers bounds how many repositories are checked at once
+	workers chan struct{}
+
+	// repoLocks holds one mutex per deploy path so webhook-triggered and
+	// polled checks of the same repository never overlap
+	repoLocksMu sync.Mutex
+	repoLocks   map[string]*sync.Mutex
+
+	// triggered holds the deploy paths with a webhook-triggered check
+	// waiting to start, so a burst of pushes queues one check per path
+	triggeredMu sync.Mutex
+	triggered   map[string]bool
+
+	// pollers holds the running schedule of each repository, keyed by deploy path
+	pollersMu sync.Mutex
+	pollers   map[string]*poller
+	pollWG    sync.WaitGroup
+
+	// scriptCtx is the parent of every script and hook context; cancelling
+	// it kills their process groups when the shutdown grace period runs out
+	scriptCtx   context.Context
+	killScripts context.CancelFunc
+
+	// shuttingDown stops new checks from starting; checks tracks running ones
+	shutdownMu   sync.RWMutex
+	shuttingDown bool
+	checks       sync.WaitGroup
+	done         chan struct{}
+	stopped      chan struct{}
+
+	// watching tracks the config file watcher, which stops with done
+	watching sync.WaitGroup
+
+	webhookServer *http.Server
 }
 
 func NewMonitorV2(config *Config) *MonitorV2 {
@@ -22,25 +61,147 @@ func NewMonitorV2(config *Config) *MonitorV2 {
 		fmt.Printf("Warning: Failed to initialize advanced logger: %v\n", err)
 	}
 
+	workers := config.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	scriptCtx, killScripts := context.WithCancel(context.Background())
+	setGitDefaults(config)
+
 	return &MonitorV2{
-		config: config,
+		config:      config,
+		workers:     make(chan struct{}, workers),
+		repoLocks:   map[string]*sync.Mutex{},
+		triggered:   map[string]bool{},
+		pollers:     map[string]*poller{},
+		scriptCtx:   scriptCtx,
+		killScripts: killScripts,
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
 	}
 }
 
+// Run monitors the configured repositories until Shutdown completes
 func (m *MonitorV2) Run() {
+	config := m.currentConfig()
 	logger.Info("Starting spdeploy monitor",
-		zap.Int("repositories", len(m.config.Repositories)),
-		zap.Int("check_interval", m.config.CheckInterval))
+		zap.Int("repositories", len(config.Repositories)),
+		zap.Int("check_interval", config.CheckInterval),
+		zap.Int("workers", cap(m.workers)))
 
-	for {
-		for _, repo := range m.config.Repositories {
-			m.checkRepository(repo)
-		}
-		time.Sleep(time.Duration(m.config.CheckInterval) * time.Second)
+	m.recoverInterrupted(config)
+
+	// Webhooks trigger checks immediately; polling below remains the fallback
+	if config.Webhook != nil && config.Webhook.Listen != "" {
+		go func() {
+			if err := m.ServeWebhooks(); err != nil {
+				logger.Error("Webhook listener stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	m.shutdownMu.RLock()
+	if !m.shuttingDown {
+		m.watching.Add(1)
+		go func() {
+			defer m.watching.Done()
+			m.watchConfig(m.done)
+		}()
+	}
+	m.shutdownMu.RUnlock()
+
+	// Each repository runs on its own schedule so a slow fetch or a long
+	// build in one doesn't delay the others
+	m.syncPollers(config)
+	<-m.stopped
+}
+
+// currentConfig returns the configuration in effect
+func (m *MonitorV2) currentConfig() *Config {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.config
+}
+
+// lockRepository takes the mutex for repo's deploy path, then its lock
+// file so CLI rollbacks and other daemons wait too, and returns the
+// function releasing both
+func (m *MonitorV2) lockRepository(repo Repository) (func(), error) {
+	key := stateKey(repo)
+
+	m.repoLocksMu.Lock()
+	mu, ok := m.repoLocks[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		m.repoLocks[key] = mu
+	}
+	m.repoLocksMu.Unlock()
+
+	mu.Lock()
+	unlockFile, err := lockFile(repoLockPath(repo))
+	if err != nil {
+		mu.Unlock()
+		return nil, err
 	}
+	return func() {
+		unlockFile()
+		mu.Unlock()
+	}, nil
 }
 
 func (m *MonitorV2) checkRepository(repo Repository) {
+	m.runCheck(repo, func() {})
+}
+
+// triggerCheck checks repo in the background unless a triggered check of it
+// is already waiting to start. It reports whether a new check was queued.
+func (m *MonitorV2) triggerCheck(repo Repository) bool {
+	key := stateKey(repo)
+	m.triggeredMu.Lock()
+	defer m.triggeredMu.Unlock()
+	if m.triggered[key] {
+		return false
+	}
+	m.triggered[key] = true
+
+	go m.runCheck(repo, func() {
+		m.triggeredMu.Lock()
+		delete(m.triggered, key)
+		m.triggeredMu.Unlock()
+	})
+	return true
+}
+
+// runCheck checks repo, calling started once the check holds repo's lock
+// or won't run at all. Pushes after that need a check of their own.
+func (m *MonitorV2) runCheck(repo Repository, started func()) {
+	if !m.beginCheck() {
+		started()
+		return
+	}
+	defer m.checks.Done()
+
+	// Take the repository lock before a worker slot so a check waiting on
+	// another check of the same path doesn't hold up other repositories
+	unlock, err := m.lockRepository(repo)
+	started()
+	if err != nil {
+		logger.Error("Failed to lock repository, skipping check",
+			zap.String("repo", repo.URL),
+			zap.Error(err))
+		return
+	}
+	defer unlock()
+
+	m.workers <- struct{}{}
+	defer func() { <-m.workers }()
+
+	// Shutdown may have started while this check was queued
+	if m.isShuttingDown() {
+		return
+	}
+
 	// Create a repository-specific logger
 	repoLogger, err := logger.NewRepoLogger(repo.URL, repo.Path)
 	if err != nil {
@@ -64,119 +225,309 @@ func (m *MonitorV2) checkRepository(repo Repository) {
 		zap.String("repo", repo.URL),
 		zap.String("branch", repo.Branch))
 
+	err = m.checkForUpdates(repo, repoLogger)
+	m.trackCheckResult(repo, err, repoLogger)
+}
+
+// checkForUpdates fetches repo and deploys new commits. It returns an error
+// when the repository can't be checked at all, e.g. a missing path or an
+// unreachable remote; failed deployments are recorded in history instead.
+func (m *MonitorV2) checkForUpdates(repo Repository, repoLogger *logger.RepoLogger) error {
+	// A rollback pins the repository until it is explicitly unpinned
+	if state := GetRepoState(repo); state.PinnedSHA != "" {
+		logInfo(repoLogger, repo, "Repository is pinned, skipping update",
+			zap.String("pinned_sha", state.PinnedSHA))
+		return nil
+	}
+
+	if repo.Strategy == StrategyRelease {
+		return m.checkRelease(repo, repoLogger)
+	}
+
 	// Check if repository exists and is valid
 	gitDir := filepath.Join(repo.Path, ".git")
 	if !fileExists(gitDir) {
-		errMsg := fmt.Sprintf("Repository path does not exist or is not a git repository: %s", repo.Path)
-		if repoLogger != nil {
-			repoLogger.Error(errMsg)
-		}
-		logger.Error(errMsg, zap.String("repo", repo.URL))
-		return
+		return fmt.Errorf("repository path does not exist or is not a git repository: %s", repo.Path)
 	}
 
-	// Get current branch
-	cmdBranch := exec.Command("git", "branch", "--show-current")
-	cmdBranch.Dir = repo.Path
-	currentBranchOutput, err := cmdBranch.Output()
-	if err != nil {
-		errMsg := "Failed to get current branch"
-		if repoLogger != nil {
-			repoLogger.Error(errMsg, zap.Error(err))
+	// Tag-tracking checkouts are detached at a tag rather than on a branch
+	if repo.Tag == "" {
+		if err := m.ensureBranch(repo, repoLogger); err != nil {
+			return err
 		}
-		logger.Error(errMsg, zap.String("repo", repo.URL), zap.Error(err))
-		return
 	}
-	currentBranch := strings.TrimSpace(string(currentBranchOutput))
 
-	// Check if we're on the correct branch
-	if currentBranch != repo.Branch {
-		// Try to checkout the correct branch
-		cmdCheckout := exec.Command("git", "checkout", repo.Branch)
-		cmdCheckout.Dir = repo.Path
-		if err := cmdCheckout.Run(); err != nil {
-			errMsg := fmt.Sprintf("Failed to checkout branch %s", repo.Branch)
-			if repoLogger != nil {
-				repoLogger.Error(errMsg, zap.Error(err))
-			}
-			logger.Error(errMsg, zap.String("repo", repo.URL), zap.Error(err))
-			return
-		}
-		if repoLogger != nil {
-			repoLogger.Info("Switched to branch", zap.String("branch", repo.Branch))
-		}
+	if err := applySparsePaths(repo, repo.Path); err != nil {
+		return err
+	}
+
+	if err := m.runHooks(repo, HookPreFetch, nil, repoLogger); err != nil {
+		logError(repoLogger, repo, "pre_fetch hook failed, skipping check", zap.Error(err))
+		return errCheckSkipped
 	}
 
 	// Fetch latest changes
-	cmdFetch := exec.Command("git", "fetch", "origin")
-	cmdFetch.Dir = repo.Path
-	if err := cmdFetch.Run(); err != nil {
-		errMsg := "Failed to fetch from origin"
-		if repoLogger != nil {
-			repoLogger.Error(errMsg, zap.Error(err))
-		}
-		logger.Error(errMsg, zap.String("repo", repo.URL), zap.Error(err))
-		return
+	if err := fetchOrigin(repo, repo.Path); err != nil {
+		return err
+	}
+
+	if repo.Tag != "" {
+		return m.checkTag(repo, repoLogger)
+	}
+
+	// Counting and fast-forwarding need HEAD within the fetched history
+	if err := deepenTo(repo, repo.Path, "HEAD", "origin/"+repo.Branch, repoLogger); err != nil {
+		return err
 	}
 
 	// Check if there are new changes
-	cmdStatus := exec.Command("git", "rev-list", "HEAD..origin/"+repo.Branch, "--count")
-	cmdStatus.Dir = repo.Path
-	statusOutput, err := cmdStatus.Output()
+	backend := backendFor(repo)
+	oldSHA, err := backend.Resolve(repo.Path, "HEAD")
 	if err != nil {
-		errMsg := "Failed to check for updates"
-		if repoLogger != nil {
-			repoLogger.Error(errMsg, zap.Error(err))
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+	newSHA, err := backend.Resolve(repo.Path, "origin/"+repo.Branch)
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+	if oldSHA == newSHA {
+		clearConflict(repo)
+		// No new commits, but a failed script for the current one may be due a retry
+		if repo.PostPullScript != "" {
+			m.retryPendingScript(repo, repoLogger)
 		}
-		logger.Error(errMsg, zap.String("repo", repo.URL), zap.Error(err))
-		return
+		return nil
 	}
 
-	commitCount := strings.TrimSpace(string(statusOutput))
-	if commitCount == "0" {
-		// No new commits
-		return
+	// Local edits or a force push would make a pull fail or create a merge commit
+	conflict, err := detectConflict(repo, "origin/"+repo.Branch)
+	if err != nil {
+		return fmt.Errorf("failed to inspect working copy: %w", err)
+	}
+	if err := conflictError(repo, conflict); err != nil {
+		m.reportConflict(repo, oldSHA, newSHA, "", err, repoLogger)
+		return nil
+	}
+
+	if err := verifySignatures(repo, repo.Path, oldSHA, newSHA); err != nil {
+		if errors.Is(err, errUnverified) {
+			m.reportUnverified(repo, oldSHA, newSHA, "", err, repoLogger)
+			return nil
+		}
+		return fmt.Errorf("failed to verify signatures: %w", err)
+	}
+
+	commitCount, err := backend.AheadCount(repo.Path, "HEAD", "origin/"+repo.Branch)
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
 	}
 
 	// New commits available, pull them
 	if repoLogger != nil {
-		repoLogger.Info("New commits detected", zap.String("count", commitCount))
+		repoLogger.Info("New commits detected", zap.Int("count", commitCount))
 	}
 	logger.Info("New commits detected",
 		zap.String("repo", repo.URL),
-		zap.String("count", commitCount))
+		zap.Int("count", commitCount))
+
+	paths, relevant, err := watchedChanges(repo, oldSHA, newSHA, repoLogger)
+	if err != nil {
+		return fmt.Errorf("failed to diff changes: %w", err)
+	}
+	directive, err := commitDirective(repo, oldSHA, newSHA, repoLogger)
+	if err != nil {
+		return err
+	}
+	switch directive {
+	case DirectiveSkip:
+		relevant = false
+	case DirectiveForceScript:
+		relevant = true
+	}
+
+	deploy := newDeployment(repo, DeployKindDeploy)
+	deploy.OldSHA = oldSHA
+	deploy.NewSHA = newSHA
+	deploy.CommitCount = commitCount
+	deploy.Paths = paths
+	deploy.Directive = directive
+	m.beginDeployment(repo, deploy)
+	defer m.recordDeployment(deploy)
+
+	// A failing pre_deploy hook vetoes the update
+	if relevant {
+		if err := m.runHooks(repo, HookPreDeploy, deploy, repoLogger); err != nil {
+			logWarn(repoLogger, repo, "Deployment vetoed by pre_deploy hook", zap.Error(err))
+			deploy.veto(err)
+			return nil
+		}
+	}
 
-	cmdPull := exec.Command("git", "pull", "origin", repo.Branch)
-	cmdPull.Dir = repo.Path
-	pullOutput, err := cmdPull.CombinedOutput()
+	// Fast-forward only, so the daemon never creates merge commits on a server.
+	// The branch was just fetched, so merge it rather than pulling it again.
+	pullOutput, err := m.updateWorkingTree(repo, deploy, "origin/"+repo.Branch, conflict, func() (string, error) {
+		return backend.FastForward(repo.Path, "origin/"+repo.Branch)
+	}, repoLogger)
+	deploy.PullOutput = pullOutput
 	if err != nil {
 		errMsg := "Failed to pull changes"
+		if errors.Is(err, errGitTimeout) {
+			errMsg = "Pull timed out"
+			recordGitTimeout(repo, "pull", err)
+		}
 		if repoLogger != nil {
-			repoLogger.Error(errMsg, zap.Error(err), zap.String("output", string(pullOutput)))
+			repoLogger.Error(errMsg, zap.Error(err), zap.String("output", pullOutput))
 		}
 		logger.Error(errMsg,
 			zap.String("repo", repo.URL),
 			zap.Error(err),
-			zap.String("output", string(pullOutput)))
-		return
+			zap.String("output", pullOutput))
+		m.finishDeployment(repo, deploy, fmt.Errorf("pull failed: %w", err), repoLogger)
+		return nil
+	}
+	deploy.NewSHA, _ = backend.Resolve(repo.Path, "HEAD")
+	if err := updateCheckoutExtras(repo, repo.Path); err != nil {
+		logError(repoLogger, repo, "Failed to update submodules or LFS files", zap.Error(err))
+		m.finishDeployment(repo, deploy, err, repoLogger)
+		return nil
 	}
 
 	// Log successful deployment
 	if repoLogger != nil {
 		repoLogger.Info("Successfully pulled changes",
-			zap.String("output", strings.TrimSpace(string(pullOutput))))
+			zap.String("output", pullOutput))
 	}
 	logger.Info("Successfully pulled changes",
 		zap.String("repo", repo.URL),
-		zap.String("output", strings.TrimSpace(string(pullOutput))))
+		zap.String("output", pullOutput))
+
+	if !relevant {
+		deploy.skip()
+		return nil
+	}
 
 	// Execute post-pull script if configured
 	if repo.PostPullScript != "" {
-		m.executePostPullScript(repo, repoLogger)
+		if directive == DirectiveNoScript {
+			logInfo(repoLogger, repo, "Post-pull script skipped by commit message directive")
+		} else {
+			err = m.executePostPullScript(repo, deploy, repoLogger)
+			deploy.setScriptResult(err)
+		}
+	}
+	m.finishDeployment(repo, deploy, err, repoLogger)
+	return nil
+}
+
+// fetchOrigin updates dir's copy of the refs repo deploys from. The remote
+// is asked for those refs with ls-remote first, and the fetch is skipped
+// when none of them changed; with shared mirrors that happens once for
+// every deploy path of the URL. A command that timed out is remembered for
+// status and reported distinctly from one that failed.
+func fetchOrigin(repo Repository, dir string) error {
+	fetch := fetchDirect
+	if usesMirror(repo) {
+		fetch = fetchFromMirror
+	}
+	command, err := fetch(repo, dir)
+	if err != nil {
+		if errors.Is(err, errGitTimeout) {
+			recordGitTimeout(repo, command, err)
+			return fmt.Errorf("%s timed out: %w", command, err)
+		}
+		return fmt.Errorf("failed to fetch from origin: %w", err)
+	}
+	clearGitTimeout(repo)
+	return nil
+}
+
+// fetchDirect asks repo's remote for its refs and fetches them into dir if
+// they changed, returning the last command run
+func fetchDirect(repo Repository, dir string) (string, error) {
+	backend := backendFor(repo)
+	changed, err := backend.RemoteChanged(repo, dir)
+	if err != nil || !changed {
+		return "ls-remote", err
+	}
+	return "fetch", backend.Fetch(repo, dir)
+}
+
+// ensureBranch checks out repo's branch if the working copy is on another one
+func (m *MonitorV2) ensureBranch(repo Repository, repoLogger *logger.RepoLogger) error {
+	backend := backendFor(repo)
+
+	// Get current branch
+	currentBranch, err := backend.CurrentBranch(repo.Path)
+	if err != nil {
+		return fmt.Errorf("failed to get current branch: %w", err)
+	}
+
+	// Check if we're on the correct branch
+	if currentBranch != repo.Branch {
+		// Try to checkout the correct branch
+		if err := backend.Checkout(repo.Path, repo.Branch); err != nil {
+			return fmt.Errorf("failed to checkout branch %s: %w", repo.Branch, err)
+		}
+		if repoLogger != nil {
+			repoLogger.Info("Switched to branch", zap.String("branch", repo.Branch))
+		}
 	}
+	return nil
 }
 
-func (m *MonitorV2) executePostPullScript(repo Repository, repoLogger *logger.RepoLogger) {
+// beginDeployment marks deploy as in progress in the state file, so a
+// deployment cut short by a crash or shutdown is noticed on the next start
+func (m *MonitorV2) beginDeployment(repo Repository, deploy *Deployment) {
+	if err := UpdateRepoState(repo, func(s *RepoState) { s.InProgress = deploy.marker() }); err != nil {
+		logger.Warn("Failed to mark deployment in progress",
+			zap.String("repo", deploy.Repo),
+			zap.String("deploy_id", deploy.ID),
+			zap.Error(err))
+	}
+}
+
+// recordDeployment saves a finished deployment to the history store and
+// clears its in-progress marker
+func (m *MonitorV2) recordDeployment(deploy *Deployment) {
+	if err := RecordDeployment(deploy); err != nil {
+		logger.Warn("Failed to record deployment history",
+			zap.String("repo", deploy.Repo),
+			zap.String("deploy_id", deploy.ID),
+			zap.Error(err))
+	}
+
+	err := updateStateEntry(deploy.Path, func(s *RepoState) {
+		if s.InProgress != nil && s.InProgress.ID == deploy.ID {
+			s.InProgress = nil
+		}
+		if deploy.Status == DeployStatusInterrupted {
+			s.Interrupted = deploy.marker()
+		} else {
+			s.Interrupted = nil
+		}
+		// Any other outcome means the conflict no longer blocks updates
+		if deploy.Status != DeployStatusConflict {
+			s.Conflict = nil
+		}
+		if deploy.Status != DeployStatusRejected {
+			s.Unverified = nil
+		}
+		if deploy.Status != DeployStatusSkipped {
+			s.SkippedSHA = ""
+		}
+	})
+	if err != nil {
+		logger.Warn("Failed to update deployment state",
+			zap.String("repo", deploy.Repo),
+			zap.String("deploy_id", deploy.ID),
+			zap.Error(err))
+	}
+}
+
+// executePostPullScript runs the repository's post-pull script from repo.Path,
+// streaming its output into the repository log, and returns an error if the
+// script is missing, fails or times out. deploy may be nil outside a deployment.
+func (m *MonitorV2) executePostPullScript(repo Repository, deploy *Deployment, repoLogger *logger.RepoLogger) error {
 	scriptPath := filepath.Join(repo.Path, repo.PostPullScript)
 	if !fileExists(scriptPath) {
 		errMsg := fmt.Sprintf("Post-pull script not found: %s", scriptPath)
@@ -184,38 +535,82 @@ func (m *MonitorV2) executePostPullScript(repo Repository, repoLogger *logger.Re
 			repoLogger.Warn(errMsg)
 		}
 		logger.Warn(errMsg, zap.String("repo", repo.URL))
-		return
+		return fmt.Errorf("post-pull script not found: %s", scriptPath)
 	}
 
-	cmd := exec.Command("/bin/sh", scriptPath)
+	ctx, cancel := scriptContext(m.scriptCtx, repo.ScriptTimeout)
+	defer cancel()
+
+	cmd, err := scriptCommand(ctx, scriptPath, repo.ScriptInterpreter)
+	if err != nil {
+		logError(repoLogger, repo, "Failed to prepare post-pull script",
+			zap.String("script", repo.PostPullScript),
+			zap.Error(err))
+		return fmt.Errorf("post-pull script failed: %w", err)
+	}
 	cmd.Dir = repo.Path
-	output, err := cmd.CombinedOutput()
+	cmd.Env = scriptEnv(repo, deploy)
+
+	logInfo(repoLogger, repo, "Running post-pull script",
+		zap.String("script", repo.PostPullScript),
+		zap.String("command", cmd.String()))
+
+	start := time.Now()
+	tail, err := runScript(cmd, func(stream, line string) {
+		if repoLogger != nil {
+			repoLogger.Info("Script output",
+				zap.String("stream", stream),
+				zap.String("line", line))
+		} else {
+			logger.Info("Script output",
+				zap.String("repo", repo.URL),
+				zap.String("stream", stream),
+				zap.String("line", line))
+		}
+	})
+	err = scriptError(ctx, repo.ScriptTimeout, err)
 
 	if err != nil {
 		errMsg := "Post-pull script failed"
-		if repoLogger != nil {
-			repoLogger.Error(errMsg,
-				zap.Error(err),
-				zap.String("script", repo.PostPullScript),
-				zap.String("output", string(output)))
+		if errors.Is(err, errScriptTimeout) {
+			errMsg = "Post-pull script timed out"
 		}
-		logger.Error(errMsg,
-			zap.String("repo", repo.URL),
+		logError(repoLogger, repo, errMsg,
 			zap.Error(err),
 			zap.String("script", repo.PostPullScript),
-			zap.String("output", string(output)))
-		return
+			zap.Duration("duration", time.Since(start)),
+			zap.String("output_tail", tail))
+		return fmt.Errorf("post-pull script failed: %w", err)
 	}
 
+	logInfo(repoLogger, repo, "Post-pull script executed successfully",
+		zap.String("script", repo.PostPullScript),
+		zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+// logInfo writes an info message to the repository log (when available) and the global log
+func logInfo(repoLogger *logger.RepoLogger, repo Repository, msg string, fields ...zap.Field) {
 	if repoLogger != nil {
-		repoLogger.Info("Post-pull script executed successfully",
-			zap.String("script", repo.PostPullScript),
-			zap.String("output", strings.TrimSpace(string(output))))
+		repoLogger.Info(msg, fields...)
 	}
-	logger.Info("Post-pull script executed successfully",
-		zap.String("repo", repo.URL),
-		zap.String("script", repo.PostPullScript),
-		zap.String("output", strings.TrimSpace(string(output))))
+	logger.Info(msg, append([]zap.Field{zap.String("repo", repo.URL)}, fields...)...)
+}
+
+// logWarn writes a warning to the repository log (when available) and the global log
+func logWarn(repoLogger *logger.RepoLogger, repo Repository, msg string, fields ...zap.Field) {
+	if repoLogger != nil {
+		repoLogger.Warn(msg, fields...)
+	}
+	logger.Warn(msg, append([]zap.Field{zap.String("repo", repo.URL)}, fields...)...)
+}
+
+// logError writes an error to the repository log (when available) and the global log
+func logError(repoLogger *logger.RepoLogger, repo Repository, msg string, fields ...zap.Field) {
+	if repoLogger != nil {
+		repoLogger.Error(msg, fields...)
+	}
+	logger.Error(msg, append([]zap.Field{zap.String("repo", repo.URL)}, fields...)...)
 }
 
 // fileExists is defined in git.go
\ No newline at end of file
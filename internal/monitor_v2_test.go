@@ -4,6 +4,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -131,11 +133,11 @@ func TestMonitorV2ExecutePostPullScript(t *testing.T) {
 	monitor := NewMonitorV2(config)
 
 	// Execute script
-	monitor.executePostPullScript(repo, nil)
+	monitor.executePostPullScript(repo, nil, nil)
 
 	// Test with non-existent script
 	repo.PostPullScript = "non-existent.sh"
-	monitor.executePostPullScript(repo, nil) // Should log warning but not panic
+	monitor.executePostPullScript(repo, nil, nil) // Should log warning but not panic
 
 	// Test with failing script
 	failScriptPath := filepath.Join(tmpDir, "fail.sh")
@@ -145,7 +147,7 @@ func TestMonitorV2ExecutePostPullScript(t *testing.T) {
 	}
 
 	repo.PostPullScript = "fail.sh"
-	monitor.executePostPullScript(repo, nil) // Should log error but not panic
+	monitor.executePostPullScript(repo, nil, nil) // Should log error but not panic
 }
 
 func TestMonitorV2RunStop(t *testing.T) {
@@ -171,4 +173,82 @@ func TestMonitorV2RunStop(t *testing.T) {
 	case <-time.After(2 * time.Second):
 		t.Fatal("Monitor run timed out")
 	}
+	monitor.Shutdown()
+}
+
+// maxOverlap returns the highest number of checks that were running at once
+// according to a log of "+" (started) and "-" (finished) lines
+func maxOverlap(t *testing.T, logPath string) int {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read check log: %v", err)
+	}
+	running, max := 0, 0
+	for _, line := range strings.Fields(string(data)) {
+		if line == "+" {
+			running++
+		} else {
+			running--
+		}
+		if running > max {
+			max = running
+		}
+	}
+	return max
+}
+
+func TestCheckConcurrency(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available")
+	}
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	logPath := filepath.Join(t.TempDir(), "checks.log")
+	hooks := &Hooks{PreFetch: []string{"echo + >> " + logPath + "; sleep 0.3; echo - >> " + logPath}}
+
+	newRepo := func(name string) Repository {
+		repo := Repository{
+			URL:    origin,
+			Branch: "main",
+			Path:   filepath.Join(t.TempDir(), name),
+			Hooks:  hooks,
+		}
+		if err := ValidateRepository(repo); err != nil {
+			t.Fatalf("ValidateRepository failed: %v", err)
+		}
+		return repo
+	}
+
+	runChecks := func(monitor *MonitorV2, repos ...Repository) {
+		os.Remove(logPath)
+		var wg sync.WaitGroup
+		for _, repo := range repos {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				monitor.checkRepository(repo)
+			}()
+		}
+		wg.Wait()
+	}
+
+	a, b, c := newRepo("a"), newRepo("b"), newRepo("c")
+
+	t.Run("WorkerPoolBound", func(t *testing.T) {
+		monitor := NewMonitorV2(&Config{CheckInterval: 60, Workers: 2})
+		runChecks(monitor, a, b, c)
+		if got := maxOverlap(t, logPath); got != 2 {
+			t.Errorf("Expected 2 concurrent checks with 2 workers, got %d", got)
+		}
+	})
+
+	t.Run("SamePathNeverOverlaps", func(t *testing.T) {
+		monitor := NewMonitorV2(&Config{CheckInterval: 60, Workers: 3})
+		runChecks(monitor, a, a, a)
+		if got := maxOverlap(t, logPath); got != 1 {
+			t.Errorf("Expected checks of the same path to be serialised, got %d concurrent", got)
+		}
+	})
 }
\ No newline at end of file
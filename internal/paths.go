@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// maxLoggedPaths caps how many changed paths are logged and kept in history
+const maxLoggedPaths = 20
+
+// watchesPaths reports whether repo only deploys changes to some paths
+func watchesPaths(repo Repository) bool {
+	return len(repo.IncludePaths) > 0 || len(repo.ExcludePaths) > 0
+}
+
+// ValidateWatchPaths checks repo's include_paths and exclude_paths
+func ValidateWatchPaths(repo Repository) error {
+	if !watchesPaths(repo) {
+		return nil
+	}
+	if repo.Strategy == StrategyRelease {
+		return fmt.Errorf("include_paths and exclude_paths are not supported with the release strategy")
+	}
+	for _, pattern := range append(append([]string{}, repo.IncludePaths...), repo.ExcludePaths...) {
+		for _, segment := range splitPattern(pattern) {
+			if _, err := path.Match(segment, ""); err != nil || pattern == "" {
+				return fmt.Errorf("invalid path pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// splitPattern splits a path pattern into segments. A trailing slash
+// matches everything below a directory, like "dir/**".
+func splitPattern(pattern string) []string {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return strings.Split(pattern, "/")
+}
+
+// matchPath reports whether file, relative to the repository root, matches
+// pattern. "*" doesn't cross directories, "**" matches any number of them,
+// and a pattern matching a directory matches everything inside it.
+func matchPath(pattern, file string) bool {
+	return matchSegments(splitPattern(pattern), strings.Split(file, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return true
+}
+
+// watchedPath reports whether a change to file should trigger a deploy of repo
+func watchedPath(repo Repository, file string) bool {
+	included := len(repo.IncludePaths) == 0
+	for _, pattern := range repo.IncludePaths {
+		if matchPath(pattern, file) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range repo.ExcludePaths {
+		if matchPath(pattern, file) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchedChanges returns the files changed between oldSHA and newSHA that
+// match repo's include_paths and exclude_paths, and whether the update
+// needs deploying at all. Without either list every update does.
+func watchedChanges(repo Repository, oldSHA, newSHA string, repoLogger *logger.RepoLogger) ([]string, bool, error) {
+	if !watchesPaths(repo) {
+		return nil, true, nil
+	}
+
+	files, err := backendFor(repo).ChangedFiles(repo.Path, oldSHA, newSHA)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list changed files: %w", err)
+	}
+	var matched []string
+	for _, file := range files {
+		if watchedPath(repo, file) {
+			matched = append(matched, file)
+		}
+	}
+
+	if len(matched) == 0 {
+		logInfo(repoLogger, repo, "No watched paths changed, updating without deploying",
+			zap.Int("changed_files", len(files)))
+		return nil, false, nil
+	}
+	logged := matched
+	if len(logged) > maxLoggedPaths {
+		logged = logged[:maxLoggedPaths]
+	}
+	logInfo(repoLogger, repo, "Watched paths changed",
+		zap.Int("matched", len(matched)),
+		zap.Int("changed_files", len(files)),
+		zap.Strings("paths", logged))
+	return logged, true, nil
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{"api/**", "api/server.go", true},
+		{"api/**", "api/v1/handlers/user.go", true},
+		{"api/**", "apis/server.go", false},
+		{"docs", "docs/guide/intro.md", true},
+		{"docs/", "docs/index.md", true},
+		{"docs/", "src/docs.go", false},
+		{"*.md", "README.md", true},
+		{"*.md", "docs/README.md", false},
+		{"**/*.md", "docs/README.md", true},
+		{"**/*.md", "README.md", true},
+		{"/go.mod", "go.mod", true},
+		{"cmd/*/main.go", "cmd/spdeploy/main.go", true},
+		{"cmd/*/main.go", "cmd/spdeploy/sub/main.go", false},
+		{"web/**/*.css", "web/static/css/site.css", true},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.file); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWatchPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    Repository
+		wantErr bool
+	}{
+		{"None", Repository{}, false},
+		{"Globs", Repository{IncludePaths: []string{"api/**", "go.mod"}, ExcludePaths: []string{"**/*.md"}}, false},
+		{"BadPattern", Repository{IncludePaths: []string{"api/[a-"}}, true},
+		{"Empty", Repository{ExcludePaths: []string{""}}, true},
+		{"Release", Repository{Strategy: StrategyRelease, IncludePaths: []string{"api/"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateWatchPaths(tt.repo); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWatchPaths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWatchedPathsDeploy(t *testing.T) {
+	for _, backend := range []string{GitBackendExec, GitBackendGoGit} {
+		t.Run(backend, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+
+			origin := newTestOrigin(t)
+			commitFile(t, origin, "deploy.sh", "#!/bin/sh\necho ran >> \"$HOME/deploys\"\n")
+
+			repo := Repository{
+				URL:            origin,
+				Branch:         "main",
+				Path:           filepath.Join(t.TempDir(), "app"),
+				PostPullScript: "deploy.sh",
+				GitBackend:     backend,
+				IncludePaths:   []string{"api/"},
+				ExcludePaths:   []string{"**/*.md"},
+			}
+			if err := ValidateRepository(repo); err != nil {
+				t.Fatalf("ValidateRepository failed: %v", err)
+			}
+			monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+			deploys := filepath.Join(os.Getenv("HOME"), "deploys")
+
+			// Only unwatched files change, so the working copy moves without deploying
+			commitFile(t, origin, "docs/guide.txt", "guide")
+			head := commitFile(t, origin, "api/README.md", "readme")
+			monitor.checkRepository(repo)
+
+			history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+			if len(history) != 1 || history[0].Status != DeployStatusSkipped || history[0].NewSHA != head {
+				t.Fatalf("Expected a skipped deployment, got %+v", history)
+			}
+			if sha := gitT(t, repo.Path, "rev-parse", "HEAD"); sha != head {
+				t.Errorf("Expected HEAD at %s after a skipped deployment, got %s", head, sha)
+			}
+			if fileExists(deploys) {
+				t.Error("Deploy script ran for unwatched changes")
+			}
+
+			// A watched file deploys
+			head = commitFile(t, origin, "api/server.go", "package api")
+			monitor.checkRepository(repo)
+
+			history, _ = LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+			if len(history) != 1 || history[0].Status != DeployStatusSuccess || history[0].NewSHA != head {
+				t.Fatalf("Expected a successful deployment, got %+v", history)
+			}
+			if paths := history[0].Paths; len(paths) != 1 || paths[0] != "api/server.go" {
+				t.Errorf("Expected api/server.go to be recorded, got %v", paths)
+			}
+			if !fileExists(deploys) {
+				t.Error("Deploy script did not run for watched changes")
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+const (
+	// StrategyPull runs git pull directly in the deploy path
+	StrategyPull = "pull"
+	// StrategyRelease deploys each commit into its own release directory
+	StrategyRelease = "release"
+
+	// defaultKeepReleases is used when a repository doesn't set KeepReleases
+	defaultKeepReleases = 5
+)
+
+// Release layout helpers. A release-strategy repository looks like:
+//
+//	<path>/repo       bare clone used for fetching
+//	<path>/releases/  one checkout per deployed commit
+//	<path>/shared/    files and directories linked into every release
+//	<path>/current -> releases/<timestamp-sha>
+
+func releaseRepoDir(repo Repository) string { return filepath.Join(repo.Path, "repo") }
+func releasesDir(repo Repository) string    { return filepath.Join(repo.Path, "releases") }
+func sharedDir(repo Repository) string      { return filepath.Join(repo.Path, "shared") }
+func currentLink(repo Repository) string    { return filepath.Join(repo.Path, "current") }
+
+// initReleaseLayout clones the bare repository and creates the release directories
+func initReleaseLayout(repo Repository) error {
+	bareDir := releaseRepoDir(repo)
+	if fileExists(filepath.Join(bareDir, "HEAD")) {
+		remoteURL, err := runGit(bareDir, "remote", "get-url", "origin")
+		if err != nil {
+			return fmt.Errorf("failed to get remote URL: %w", err)
+		}
+		if remoteURL != repo.URL {
+			return fmt.Errorf("directory already contains a different repository: %s", remoteURL)
+		}
+		return nil
+	}
+
+	if _, err := runRemoteGit(repo, repo.Path, withArgs([]string{"clone", "--bare", repo.URL, bareDir}, depthArgs(repo)...)...); err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	// Bare clones don't track remote branches; configure them so origin/<branch> resolves
+	if _, err := runGit(bareDir, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		return err
+	}
+	if _, err := runRemoteGit(repo, bareDir, withArgs([]string{"fetch", "origin"}, depthArgs(repo)...)...); err != nil {
+		return err
+	}
+
+	for _, dir := range []string{releasesDir(repo), sharedDir(repo)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// currentReleaseSHA returns the commit deployed by the current release, or "" if none
+func currentReleaseSHA(repo Repository) string {
+	target, err := filepath.EvalSymlinks(currentLink(repo))
+	if err != nil {
+		return ""
+	}
+	sha, err := runGit(target, "rev-parse", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return sha
+}
+
+// checkRelease fetches the repository and deploys a new release if the branch
+// moved or, in tag mode, a higher matching tag appeared
+func (m *MonitorV2) checkRelease(repo Repository, repoLogger *logger.RepoLogger) error {
+	bareDir := releaseRepoDir(repo)
+	if !fileExists(filepath.Join(bareDir, "HEAD")) {
+		return fmt.Errorf("release repository does not exist: %s", bareDir)
+	}
+
+	if err := m.runHooks(repo, HookPreFetch, nil, repoLogger); err != nil {
+		logError(repoLogger, repo, "pre_fetch hook failed, skipping check", zap.Error(err))
+		return errCheckSkipped
+	}
+
+	if err := fetchOrigin(repo, bareDir); err != nil {
+		return err
+	}
+
+	ref, newSHA, err := resolveTarget(repo, bareDir)
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+	if ref == "" {
+		logWarn(repoLogger, repo, "No tag matches the pattern", zap.String("tag", repo.Tag))
+		return nil
+	}
+
+	oldSHA := currentReleaseSHA(repo)
+	if oldSHA == newSHA {
+		return nil
+	}
+	if oldSHA != "" {
+		if err := deepenTo(repo, bareDir, oldSHA, newSHA, repoLogger); err != nil {
+			return err
+		}
+	}
+
+	// A commit whose script failed isn't current yet; rebuild it only once its backoff has elapsed
+	if retry := GetRepoState(repo).ScriptRetry; retry != nil && retry.SHA == newSHA {
+		switch {
+		case retry.Status == ScriptRetryAbandoned:
+			return nil
+		case retry.Status == ScriptRetryPending && !retry.Due(time.Now()):
+			return nil
+		}
+	}
+
+	tag := ""
+	if repo.Tag != "" {
+		tag = ref
+	}
+	if err := verifySignatures(repo, bareDir, oldSHA, newSHA); err != nil {
+		if errors.Is(err, errUnverified) {
+			m.reportUnverified(repo, oldSHA, newSHA, tag, err, repoLogger)
+			return nil
+		}
+		return fmt.Errorf("failed to verify signatures: %w", err)
+	}
+
+	// The first release always deploys
+	directive := ""
+	if oldSHA != "" {
+		if directive, err = commitDirective(repo, oldSHA, newSHA, repoLogger); err != nil {
+			return err
+		}
+	}
+	if directive == DirectiveSkip {
+		m.skipRelease(repo, oldSHA, newSHA, tag, repoLogger)
+		return nil
+	}
+
+	logInfo(repoLogger, repo, "New commits detected",
+		zap.String("old_sha", oldSHA),
+		zap.String("new_sha", newSHA))
+
+	deploy := newDeployment(repo, DeployKindDeploy)
+	deploy.Tag = tag
+	deploy.OldSHA = oldSHA
+	deploy.NewSHA = newSHA
+	deploy.CommitCount = countCommits(repo, bareDir, oldSHA, newSHA)
+	deploy.Directive = directive
+	m.beginDeployment(repo, deploy)
+	defer m.recordDeployment(deploy)
+
+	err = m.deployRelease(repo, newSHA, deploy, repoLogger)
+	if errors.Is(err, errVetoed) {
+		logWarn(repoLogger, repo, "Deployment vetoed by pre_deploy hook", zap.Error(err))
+		deploy.veto(err)
+		return nil
+	}
+	if err != nil {
+		logError(repoLogger, repo, "Release deployment failed", zap.Error(err))
+	}
+	m.finishDeployment(repo, deploy, err, repoLogger)
+	if err != nil {
+		return nil
+	}
+
+	pruneReleases(repo, repoLogger)
+	return nil
+}
+
+// skipRelease records that a skip directive left newSHA undeployed. Unlike
+// a pull, nothing is checked out: a release activated without its script
+// could take the site down. Later checks find the same commits, so they
+// are only recorded once.
+func (m *MonitorV2) skipRelease(repo Repository, oldSHA, newSHA, tag string, repoLogger *logger.RepoLogger) {
+	if GetRepoState(repo).SkippedSHA == newSHA {
+		return
+	}
+	logInfo(repoLogger, repo, "Release skipped by commit message directive",
+		zap.String("old_sha", oldSHA),
+		zap.String("new_sha", newSHA))
+
+	deploy := newDeployment(repo, DeployKindDeploy)
+	deploy.Tag = tag
+	deploy.OldSHA = oldSHA
+	deploy.NewSHA = newSHA
+	deploy.CommitCount = countCommits(repo, releaseRepoDir(repo), oldSHA, newSHA)
+	deploy.Directive = DirectiveSkip
+	deploy.skip()
+	m.recordDeployment(deploy)
+
+	if err := UpdateRepoState(repo, func(s *RepoState) { s.SkippedSHA = newSHA }); err != nil {
+		logWarn(repoLogger, repo, "Failed to save skipped release", zap.Error(err))
+	}
+}
+
+// errVetoed marks a release refused by a pre_deploy hook
+var errVetoed = errors.New("vetoed")
+
+// deployRelease checks sha out into a new release directory, links shared
+// paths, runs the pre_deploy hooks and post-pull script there and then
+// switches current to it. Hooks of the deployment run in the release.
+func (m *MonitorV2) deployRelease(repo Repository, sha string, deploy *Deployment, repoLogger *logger.RepoLogger) error {
+	name := fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102150405.000000"), shortSHA(sha))
+	releaseDir := filepath.Join(releasesDir(repo), name)
+
+	output, err := runGit(releaseRepoDir(repo), "worktree", "add", "--detach", releaseDir, sha)
+	deploy.PullOutput = output
+	if err != nil {
+		return fmt.Errorf("failed to create release %s: %w", name, err)
+	}
+	deploy.dir = releaseDir
+
+	if err := updateCheckoutExtras(repo, releaseDir); err != nil {
+		removeRelease(repo, releaseDir)
+		return fmt.Errorf("release %s not activated: %w", name, err)
+	}
+
+	if err := linkSharedPaths(repo, releaseDir); err != nil {
+		removeRelease(repo, releaseDir)
+		return err
+	}
+
+	// Rollbacks return to a release that was already let through
+	if deploy.Kind == DeployKindDeploy {
+		if err := m.runHooks(repo, HookPreDeploy, deploy, repoLogger); err != nil {
+			removeRelease(repo, releaseDir)
+			return fmt.Errorf("release %s %w: %w", name, errVetoed, err)
+		}
+	}
+
+	if repo.PostPullScript != "" && deploy.Directive == DirectiveNoScript {
+		logInfo(repoLogger, repo, "Post-pull script skipped by commit message directive")
+	} else if repo.PostPullScript != "" {
+		releaseRepo := repo
+		releaseRepo.Path = releaseDir
+		err := m.executePostPullScript(releaseRepo, deploy, repoLogger)
+		deploy.setScriptResult(err)
+		if err != nil {
+			// The live site keeps serving the previous release
+			removeRelease(repo, releaseDir)
+			return fmt.Errorf("release %s not activated: %w", name, err)
+		}
+	}
+
+	if err := switchCurrent(repo, name); err != nil {
+		return err
+	}
+
+	logInfo(repoLogger, repo, "Activated release",
+		zap.String("release", name),
+		zap.String("sha", sha))
+	return nil
+}
+
+// linkSharedPaths replaces each shared path in the release with a symlink into shared/.
+// If shared/ doesn't have the path yet, the release's copy seeds it. Paths ending in
+// "/" are created as empty directories when neither side has them.
+func linkSharedPaths(repo Repository, releaseDir string) error {
+	for _, shared := range repo.SharedPaths {
+		rel := filepath.Clean(shared)
+		if rel == "." || !filepath.IsLocal(rel) {
+			return fmt.Errorf("invalid shared path: %s", shared)
+		}
+
+		src := filepath.Join(sharedDir(repo), rel)
+		dst := filepath.Join(releaseDir, rel)
+
+		if err := os.MkdirAll(filepath.Dir(src), 0755); err != nil {
+			return fmt.Errorf("failed to create shared directory: %w", err)
+		}
+
+		if _, err := os.Lstat(src); os.IsNotExist(err) {
+			if _, err := os.Lstat(dst); err == nil {
+				if err := os.Rename(dst, src); err != nil {
+					return fmt.Errorf("failed to seed shared path %s: %w", rel, err)
+				}
+			} else if strings.HasSuffix(shared, "/") {
+				if err := os.MkdirAll(src, 0755); err != nil {
+					return fmt.Errorf("failed to create shared path %s: %w", rel, err)
+				}
+			} else {
+				return fmt.Errorf("shared path %s does not exist in %s", rel, sharedDir(repo))
+			}
+		}
+
+		if err := os.RemoveAll(dst); err != nil {
+			return fmt.Errorf("failed to replace %s with shared link: %w", rel, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", rel, err)
+		}
+		if err := os.Symlink(src, dst); err != nil {
+			return fmt.Errorf("failed to link shared path %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// switchCurrent atomically points Path/current at releases/<name>
+func switchCurrent(repo Repository, name string) error {
+	link := currentLink(repo)
+	tmp := fmt.Sprintf("%s.tmp-%d", link, os.Getpid())
+
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Join("releases", name), tmp); err != nil {
+		return fmt.Errorf("failed to create current link: %w", err)
+	}
+	// rename(2) replaces the old link in a single step, so current is never missing
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to switch current release: %w", err)
+	}
+	return nil
+}
+
+// pruneReleases removes the oldest releases beyond KeepReleases, never touching current
+func pruneReleases(repo Repository, repoLogger *logger.RepoLogger) {
+	keep := repo.KeepReleases
+	if keep <= 0 {
+		keep = defaultKeepReleases
+	}
+
+	names, err := listReleases(repo)
+	if err != nil || len(names) <= keep {
+		return
+	}
+
+	current, _ := os.Readlink(currentLink(repo))
+	current = filepath.Base(current)
+
+	for _, name := range names[:len(names)-keep] {
+		if name == current {
+			continue
+		}
+		removeRelease(repo, filepath.Join(releasesDir(repo), name))
+		logInfo(repoLogger, repo, "Removed old release", zap.String("release", name))
+	}
+}
+
+// listReleases returns release directory names, oldest first
+func listReleases(repo Repository) ([]string, error) {
+	entries, err := os.ReadDir(releasesDir(repo))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	// Names start with a UTC timestamp, so lexical order is chronological
+	sort.Strings(names)
+	return names, nil
+}
+
+// removeRelease deletes a release checkout and its worktree metadata
+func removeRelease(repo Repository, releaseDir string) {
+	if _, err := runGit(releaseRepoDir(repo), "worktree", "remove", "--force", releaseDir); err != nil {
+		os.RemoveAll(releaseDir)
+		runGit(releaseRepoDir(repo), "worktree", "prune")
+	}
+}
+
+// shortSHA abbreviates a commit hash for display and directory names
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitT runs a git command in dir and fails the test on error
+func gitT(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newTestOrigin creates a local repository on branch main with one commit
+func newTestOrigin(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	dir := filepath.Join(t.TempDir(), "origin")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create origin dir: %v", err)
+	}
+	gitT(t, dir, "init", "-b", "main")
+	gitT(t, dir, "config", "user.email", "test@example.com")
+	gitT(t, dir, "config", "user.name", "Test User")
+	commitFile(t, dir, "index.html", "v1")
+	return dir
+}
+
+// commitFile writes a file in dir and commits it, returning the new HEAD
+func commitFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	gitT(t, dir, "add", ".")
+	gitT(t, dir, "commit", "-m", "Update "+name)
+	return gitT(t, dir, "rev-parse", "HEAD")
+}
+
+func TestReleaseStrategy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	commitFile(t, origin, "deploy.sh", "#!/bin/sh\necho built > build.txt\n")
+
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "site"),
+		PostPullScript: "deploy.sh",
+		Strategy:       StrategyRelease,
+		SharedPaths:    []string{"uploads/"},
+		KeepReleases:   2,
+	}
+
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	t.Run("FirstRelease", func(t *testing.T) {
+		monitor.checkRepository(repo)
+
+		if got, want := currentReleaseSHA(repo), gitT(t, origin, "rev-parse", "HEAD"); got != want {
+			t.Fatalf("Expected current release at %s, got %q", want, got)
+		}
+		if !fileExists(filepath.Join(currentLink(repo), "build.txt")) {
+			t.Error("Post-pull script did not run in the release directory")
+		}
+		if target, err := os.Readlink(filepath.Join(currentLink(repo), "uploads")); err != nil || target != filepath.Join(sharedDir(repo), "uploads") {
+			t.Errorf("Expected uploads to link into shared, got %q (%v)", target, err)
+		}
+	})
+
+	t.Run("FailedScriptKeepsCurrent", func(t *testing.T) {
+		before := currentReleaseSHA(repo)
+		commitFile(t, origin, "deploy.sh", "#!/bin/sh\nexit 1\n")
+
+		monitor.checkRepository(repo)
+
+		if got := currentReleaseSHA(repo); got != before {
+			t.Errorf("Current release changed after failed script: %s -> %s", before, got)
+		}
+	})
+
+	t.Run("PrunesOldReleases", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			commitFile(t, origin, "deploy.sh", "#!/bin/sh\necho ok\n"+strings.Repeat("#", i)+"\n")
+			monitor.checkRepository(repo)
+		}
+
+		names, err := listReleases(repo)
+		if err != nil {
+			t.Fatalf("Failed to list releases: %v", err)
+		}
+		if len(names) != 2 {
+			t.Errorf("Expected 2 releases to be kept, got %d: %v", len(names), names)
+		}
+		if got, want := currentReleaseSHA(repo), gitT(t, origin, "rev-parse", "HEAD"); got != want {
+			t.Errorf("Expected current release at %s, got %q", want, got)
+		}
+		if !fileExists(filepath.Join(sharedDir(repo), "uploads")) {
+			t.Error("Pruning releases removed shared data")
+		}
+	})
+}
+
+func TestLinkSharedPathsRejectsEscapes(t *testing.T) {
+	repo := Repository{Path: t.TempDir(), SharedPaths: []string{"../etc"}}
+	if err := linkSharedPaths(repo, filepath.Join(repo.Path, "releases", "r1")); err == nil {
+		t.Error("Expected error for shared path outside the release")
+	}
+
+	// A name that merely starts with ".." stays inside the release
+	repo.SharedPaths = []string{"..cache/"}
+	releaseDir := filepath.Join(repo.Path, "releases", "r1")
+	os.MkdirAll(releaseDir, 0755)
+	if err := linkSharedPaths(repo, releaseDir); err != nil {
+		t.Errorf("linkSharedPaths rejected a local path: %v", err)
+	}
+}
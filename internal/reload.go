@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// configReloadDelay collapses the burst of events editors produce when saving
+const configReloadDelay = 500 * time.Millisecond
+
+// poller is the running schedule of one repository
+type poller struct {
+	repo     Repository
+	schedule string
+	stop     chan struct{}
+}
+
+// ReloadConfig re-reads the config file and applies it to the running monitor.
+// An invalid config is rejected and the current one stays in effect.
+func (m *MonitorV2) ReloadConfig() error {
+	if !fileExists(getConfigPath()) {
+		err := fmt.Errorf("config file %s not found", getConfigPath())
+		logger.Error("Rejected config reload, keeping the current config", zap.Error(err))
+		return err
+	}
+
+	config, err := ReadConfig()
+	if err != nil {
+		logger.Error("Rejected invalid config, keeping the current config", zap.Error(err))
+		return err
+	}
+
+	m.applyConfig(config)
+	return nil
+}
+
+// applyConfig swaps in config and starts, stops or restarts repository schedules
+// to match it. Checks already in progress are left to finish.
+func (m *MonitorV2) applyConfig(config *Config) {
+	m.configMu.Lock()
+	old := m.config
+	m.config = config
+	m.configMu.Unlock()
+	setGitDefaults(config)
+
+	if old.CheckInterval != config.CheckInterval || old.Jitter != config.Jitter {
+		logger.Info("Global schedule changed",
+			zap.Int("check_interval", config.CheckInterval),
+			zap.Int("jitter", config.Jitter))
+	}
+	if old.GitTimeout != config.GitTimeout {
+		logger.Info("Git timeout changed", zap.Duration("git_timeout", gitTimeout(nil)))
+	}
+	if old.Workers != config.Workers {
+		logger.Warn("Changing workers takes effect after a restart", zap.Int("workers", config.Workers))
+	}
+	if !reflect.DeepEqual(webhookAddr(old), webhookAddr(config)) {
+		logger.Warn("Changing the webhook listen address or path takes effect after a restart")
+	}
+
+	m.syncPollers(config)
+	logger.Info("Configuration reloaded", zap.Int("repositories", len(config.Repositories)))
+}
+
+// webhookAddr returns the webhook settings that can only change on restart
+func webhookAddr(config *Config) [2]string {
+	if config.Webhook == nil {
+		return [2]string{}
+	}
+	return [2]string{config.Webhook.Listen, config.Webhook.Path}
+}
+
+// syncPollers makes the running schedules match config's repositories
+func (m *MonitorV2) syncPollers(config *Config) {
+	m.pollersMu.Lock()
+	defer m.pollersMu.Unlock()
+
+	wanted := make(map[string]Repository, len(config.Repositories))
+	for _, repo := range config.Repositories {
+		wanted[stateKey(repo)] = repo
+	}
+
+	for key, p := range m.pollers {
+		repo, ok := wanted[key]
+		switch {
+		case !ok:
+			logger.Info("Stopped monitoring repository", zap.String("repo", p.repo.URL), zap.String("path", key))
+		case !reflect.DeepEqual(repo, p.repo) || DescribeSchedule(config, repo) != p.schedule:
+			logger.Info("Repository configuration changed", zap.String("repo", repo.URL), zap.String("path", key))
+		default:
+			continue
+		}
+		close(p.stop)
+		delete(m.pollers, key)
+	}
+
+	for _, repo := range config.Repositories {
+		key := stateKey(repo)
+		if _, ok := m.pollers[key]; ok {
+			continue
+		}
+		m.startPoller(config, repo)
+	}
+}
+
+// startPoller starts checking repo on its schedule. The caller holds pollersMu.
+func (m *MonitorV2) startPoller(config *Config, repo Repository) {
+	schedule, err := newRepoSchedule(config, repo)
+	if err != nil {
+		// ReadConfig rejects invalid schedules, so this only happens for hand-built configs
+		logger.Error("Invalid schedule, using check interval", zap.String("repo", repo.URL), zap.Error(err))
+		repo.Schedule = ""
+		schedule, _ = newRepoSchedule(config, repo)
+	}
+
+	p := &poller{repo: repo, schedule: schedule.String(), stop: make(chan struct{})}
+	m.pollers[stateKey(repo)] = p
+
+	logger.Info("Monitoring repository",
+		zap.String("repo", repo.URL),
+		zap.String("path", repo.Path),
+		zap.String("schedule", p.schedule))
+
+	m.pollWG.Add(1)
+	go func() {
+		defer m.pollWG.Done()
+		m.pollRepository(repo, schedule, p.stop)
+	}()
+}
+
+// pollRepository checks repo on its schedule until stop is closed
+func (m *MonitorV2) pollRepository(repo Repository, schedule *repoSchedule, stop <-chan struct{}) {
+	// Jitter the first check too, so a fleet restarted together doesn't fetch in lockstep
+	if !waitOrStop(schedule.randomJitter(), stop) {
+		return
+	}
+	for {
+		m.checkRepository(repo)
+		next := nextCheckAfter(repo, schedule.next(time.Now()))
+		if !waitOrStop(time.Until(next), stop) {
+			return
+		}
+	}
+}
+
+// stopPollers stops every repository schedule and waits for in-flight checks to finish
+func (m *MonitorV2) stopPollers() {
+	m.cancelPollers()
+	m.pollWG.Wait()
+}
+
+// cancelPollers stops every repository schedule without waiting
+func (m *MonitorV2) cancelPollers() {
+	m.pollersMu.Lock()
+	defer m.pollersMu.Unlock()
+
+	for key, p := range m.pollers {
+		close(p.stop)
+		delete(m.pollers, key)
+	}
+}
+
+// waitOrStop waits for d, returning false if stop is closed first
+func waitOrStop(d time.Duration, stop <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// watchConfig reloads the configuration whenever the config file changes,
+// until stop is closed
+func (m *MonitorV2) watchConfig(stop <-chan struct{}) {
+	configPath := getConfigPath()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn("Config file watching unavailable, send SIGHUP to reload", zap.Error(err))
+		return
+	}
+	defer watcher.Close()
+
+	// Watch the directory: SaveConfig and most editors replace the file rather than writing it in place
+	if err := watcher.Add(filepath.Dir(configPath)); err != nil {
+		logger.Warn("Config file watching unavailable, send SIGHUP to reload", zap.Error(err))
+		return
+	}
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == configPath {
+				reload = time.After(configReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("Config file watcher error", zap.Error(err))
+		case <-reload:
+			reload = nil
+			logger.Info("Config file changed, reloading", zap.String("path", configPath))
+			m.ReloadConfig()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func pollerKeys(m *MonitorV2) []string {
+	m.pollersMu.Lock()
+	defer m.pollersMu.Unlock()
+
+	var keys []string
+	for key := range m.pollers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestApplyConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	base := t.TempDir()
+
+	// Paths without a checkout make each check fail fast
+	repoA := Repository{URL: "git@example.com:a.git", Branch: "main", Path: filepath.Join(base, "a"), Interval: 3600}
+	repoB := Repository{URL: "git@example.com:b.git", Branch: "main", Path: filepath.Join(base, "b"), Interval: 3600}
+	repoC := Repository{URL: "git@example.com:c.git", Branch: "main", Path: filepath.Join(base, "c"), Interval: 3600}
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repoA, repoB}})
+	defer monitor.stopPollers()
+
+	monitor.syncPollers(monitor.currentConfig())
+	if got := pollerKeys(monitor); len(got) != 2 || got[0] != repoA.Path || got[1] != repoB.Path {
+		t.Fatalf("Expected pollers for a and b, got %v", got)
+	}
+	monitor.pollersMu.Lock()
+	pollerA, pollerB := monitor.pollers[repoA.Path], monitor.pollers[repoB.Path]
+	monitor.pollersMu.Unlock()
+
+	// Remove b, change a's branch and add c
+	changedA := repoA
+	changedA.Branch = "release"
+	monitor.applyConfig(&Config{CheckInterval: 60, Repositories: []Repository{changedA, repoC}})
+
+	if got := pollerKeys(monitor); len(got) != 2 || got[0] != repoA.Path || got[1] != repoC.Path {
+		t.Fatalf("Expected pollers for a and c, got %v", got)
+	}
+	for name, p := range map[string]*poller{"removed": pollerB, "changed": pollerA} {
+		select {
+		case <-p.stop:
+		default:
+			t.Errorf("Expected the %s repository's old poller to be stopped", name)
+		}
+	}
+	monitor.pollersMu.Lock()
+	if p := monitor.pollers[repoA.Path]; p.repo.Branch != "release" {
+		t.Errorf("Expected restarted poller to use the new branch, got %s", p.repo.Branch)
+	}
+	monitor.pollersMu.Unlock()
+
+	// A global interval change only restarts repositories that use it
+	monitor.pollersMu.Lock()
+	pollerC := monitor.pollers[repoC.Path]
+	monitor.pollersMu.Unlock()
+	usesGlobal := repoC
+	usesGlobal.Interval = 0
+	monitor.applyConfig(&Config{CheckInterval: 60, Repositories: []Repository{changedA, usesGlobal}})
+	monitor.pollersMu.Lock()
+	pollerA = monitor.pollers[repoA.Path]
+	monitor.pollersMu.Unlock()
+	monitor.applyConfig(&Config{CheckInterval: 120, Repositories: []Repository{changedA, usesGlobal}})
+	monitor.pollersMu.Lock()
+	if monitor.pollers[repoA.Path] != pollerA {
+		t.Error("Repository with its own interval was restarted by a global interval change")
+	}
+	if monitor.pollers[repoC.Path] == pollerC {
+		t.Error("Repository using the global interval kept its old schedule")
+	}
+	monitor.pollersMu.Unlock()
+}
+
+func TestReloadConfigRejectsInvalid(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := SaveConfig(&Config{CheckInterval: 60}); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	cfg, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+	monitor := NewMonitorV2(cfg)
+	defer monitor.stopPollers()
+
+	invalid := map[string]string{
+		"BrokenJSON":      `{"check_interval": 60, "repositories": [`,
+		"InvalidSchedule": `{"repositories": [{"url": "git@example.com:a.git", "branch": "main", "path": "/srv/a", "schedule": "sometimes"}]}`,
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(getConfigPath(), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := monitor.ReloadConfig(); err == nil {
+				t.Error("Expected invalid config to be rejected")
+			}
+			if monitor.currentConfig() != cfg {
+				t.Error("Expected the current config to be kept")
+			}
+		})
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := SaveConfig(&Config{CheckInterval: 60}); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	monitor := NewMonitorV2(LoadConfig())
+	defer monitor.stopPollers()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		monitor.watchConfig(stop)
+		close(stopped)
+	}()
+	// The watcher must be gone before the next test replaces the logger
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	// Give the watcher time to start
+	time.Sleep(100 * time.Millisecond)
+
+	repo := Repository{URL: "git@example.com:a.git", Branch: "main", Path: filepath.Join(t.TempDir(), "a"), Interval: 3600}
+	if err := SaveConfig(&Config{CheckInterval: 60, Repositories: []Repository{repo}}); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(pollerKeys(monitor)) == 1 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("Config change was not picked up by the watcher")
+}
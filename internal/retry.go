@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// Script retry states
+const (
+	// ScriptRetryPending means the script failed and will be retried
+	ScriptRetryPending = "pending"
+	// ScriptRetrySucceeded means a retry eventually succeeded
+	ScriptRetrySucceeded = "succeeded"
+	// ScriptRetryAbandoned means the retry limit was reached
+	ScriptRetryAbandoned = "abandoned"
+)
+
+const (
+	// defaultScriptRetries is used when a repository doesn't set ScriptRetries
+	defaultScriptRetries = 5
+
+	scriptRetryBaseDelay = time.Minute
+	scriptRetryMaxDelay  = time.Hour
+)
+
+// ScriptRetry is the persisted retry state of a failed post-pull script.
+// Once git has moved HEAD to the new commit there are no new commits to
+// trigger another run, so the monitor retries the script on its own.
+type ScriptRetry struct {
+	SHA    string `json:"sha"`
+	Status string `json:"status"`
+	// Attempts counts script runs for SHA, including the original deployment
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastAttempt time.Time `json:"last_attempt"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+}
+
+// Due reports whether a pending retry should run now
+func (r *ScriptRetry) Due(now time.Time) bool {
+	return r != nil && r.Status == ScriptRetryPending && !now.Before(r.NextAttempt)
+}
+
+// maxScriptRetries returns the retry limit for repo
+func maxScriptRetries(repo Repository) int {
+	if repo.ScriptRetries < 0 {
+		return 0
+	}
+	if repo.ScriptRetries == 0 {
+		return defaultScriptRetries
+	}
+	return repo.ScriptRetries
+}
+
+// scriptRetryDelay returns the backoff before the next retry, doubling after
+// every failed attempt up to scriptRetryMaxDelay
+func scriptRetryDelay(attempts int) time.Duration {
+	delay := scriptRetryBaseDelay
+	for i := 1; i < attempts && delay < scriptRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > scriptRetryMaxDelay {
+		delay = scriptRetryMaxDelay
+	}
+	return delay
+}
+
+// trackScriptResult updates the persisted retry state once deploy has finished
+func trackScriptResult(repo Repository, deploy *Deployment, repoLogger *logger.RepoLogger) {
+	if deploy.Kind == DeployKindRollback {
+		return
+	}
+
+	scriptFailed := deploy.ScriptExitCode != nil && *deploy.ScriptExitCode != 0
+	if !scriptFailed && deploy.Status != DeployStatusSuccess {
+		// The update itself failed, so whatever was pending still applies
+		return
+	}
+
+	err := UpdateRepoState(repo, func(s *RepoState) {
+		prev := s.ScriptRetry
+		samePending := prev != nil && prev.Status == ScriptRetryPending && prev.SHA == deploy.NewSHA
+
+		if !scriptFailed {
+			if samePending {
+				prev.Status = ScriptRetrySucceeded
+				prev.Attempts++
+				prev.LastError = ""
+				prev.LastAttempt = deploy.FinishedAt
+				prev.NextAttempt = time.Time{}
+				logInfo(repoLogger, repo, "Post-pull script succeeded on retry",
+					zap.String("sha", prev.SHA),
+					zap.Int("attempts", prev.Attempts))
+			} else {
+				s.ScriptRetry = nil
+			}
+			return
+		}
+
+		retry := &ScriptRetry{SHA: deploy.NewSHA, Status: ScriptRetryPending}
+		if samePending {
+			retry = prev
+		}
+		retry.Attempts++
+		retry.LastError = deploy.Error
+		retry.LastAttempt = deploy.FinishedAt
+		retry.NextAttempt = time.Time{}
+
+		if retry.Attempts > maxScriptRetries(repo) {
+			retry.Status = ScriptRetryAbandoned
+			logError(repoLogger, repo, "Post-pull script retry limit reached, giving up",
+				zap.String("sha", retry.SHA),
+				zap.Int("attempts", retry.Attempts))
+		} else {
+			retry.NextAttempt = deploy.FinishedAt.Add(scriptRetryDelay(retry.Attempts))
+			logWarn(repoLogger, repo, "Post-pull script will be retried",
+				zap.String("sha", retry.SHA),
+				zap.Int("attempts", retry.Attempts),
+				zap.Time("next_attempt", retry.NextAttempt))
+		}
+		s.ScriptRetry = retry
+	})
+	if err != nil {
+		logWarn(repoLogger, repo, "Failed to save script retry state", zap.Error(err))
+	}
+}
+
+// retryPendingScript re-runs the post-pull script for the commit at HEAD if a
+// previous run failed and its backoff has elapsed
+func (m *MonitorV2) retryPendingScript(repo Repository, repoLogger *logger.RepoLogger) {
+	retry := GetRepoState(repo).ScriptRetry
+	if retry == nil || retry.Status != ScriptRetryPending {
+		return
+	}
+
+	head, err := backendFor(repo).Resolve(repo.Path, "HEAD")
+	if err != nil {
+		logError(repoLogger, repo, "Failed to resolve HEAD for script retry", zap.Error(err))
+		return
+	}
+	if head != retry.SHA {
+		// HEAD was moved outside spdeploy; the failed commit is no longer deployed
+		logWarn(repoLogger, repo, "Dropping script retry for commit that is no longer checked out",
+			zap.String("sha", retry.SHA),
+			zap.String("head", head))
+		UpdateRepoState(repo, func(s *RepoState) { s.ScriptRetry = nil })
+		return
+	}
+	if !retry.Due(time.Now()) {
+		return
+	}
+
+	logInfo(repoLogger, repo, "Retrying post-pull script",
+		zap.String("sha", retry.SHA),
+		zap.Int("attempt", retry.Attempts+1))
+
+	deploy := newDeployment(repo, DeployKindRetry)
+	deploy.Tag = tagAt(repo, repo.Path, head)
+	deploy.OldSHA = head
+	deploy.NewSHA = head
+	m.beginDeployment(repo, deploy)
+	defer m.recordDeployment(deploy)
+
+	err = m.executePostPullScript(repo, deploy, repoLogger)
+	deploy.setScriptResult(err)
+	m.finishDeployment(repo, deploy, err, repoLogger)
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScriptRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := scriptRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("scriptRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// makeRetryDue moves a pending retry's backoff into the past
+func makeRetryDue(t *testing.T, repo Repository) {
+	t.Helper()
+	if err := UpdateRepoState(repo, func(s *RepoState) {
+		if s.ScriptRetry != nil {
+			s.ScriptRetry.NextAttempt = time.Now().Add(-time.Second)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPendingScriptRetry(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// The script fails while the marker exists
+	broken := filepath.Join(t.TempDir(), "broken")
+	os.WriteFile(broken, nil, 0644)
+
+	origin := newTestOrigin(t)
+	commitFile(t, origin, "deploy.sh", "#!/bin/sh\ntest ! -f "+broken+"\n")
+
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "app"),
+		PostPullScript: "deploy.sh",
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	sha := commitFile(t, origin, "a.txt", "a")
+	monitor.checkRepository(repo)
+
+	retry := GetRepoState(repo).ScriptRetry
+	if retry == nil || retry.Status != ScriptRetryPending || retry.SHA != sha || retry.Attempts != 1 {
+		t.Fatalf("Expected pending retry for %s after first failure, got %+v", sha, retry)
+	}
+
+	// Not due yet: nothing runs
+	monitor.checkRepository(repo)
+	if got := GetRepoState(repo).ScriptRetry.Attempts; got != 1 {
+		t.Errorf("Retry ran before its backoff elapsed (attempts %d)", got)
+	}
+
+	makeRetryDue(t, repo)
+	monitor.checkRepository(repo)
+	if retry := GetRepoState(repo).ScriptRetry; retry.Attempts != 2 || retry.Status != ScriptRetryPending {
+		t.Errorf("Expected second failed attempt, got %+v", retry)
+	}
+
+	os.Remove(broken)
+	makeRetryDue(t, repo)
+	monitor.checkRepository(repo)
+	retry = GetRepoState(repo).ScriptRetry
+	if retry.Status != ScriptRetrySucceeded || retry.Attempts != 3 {
+		t.Errorf("Expected retry to succeed on third attempt, got %+v", retry)
+	}
+
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+	if len(history) != 1 || history[0].Kind != DeployKindRetry || history[0].Status != DeployStatusSuccess {
+		t.Errorf("Expected successful retry in history, got %+v", history)
+	}
+
+	// A fresh deployment clears the old outcome
+	commitFile(t, origin, "b.txt", "b")
+	monitor.checkRepository(repo)
+	if retry := GetRepoState(repo).ScriptRetry; retry != nil {
+		t.Errorf("Expected retry state to be cleared by a new deployment, got %+v", retry)
+	}
+}
+
+func TestPendingScriptRetryLimit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	commitFile(t, origin, "deploy.sh", "#!/bin/sh\nexit 1\n")
+
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "app"),
+		PostPullScript: "deploy.sh",
+		ScriptRetries:  1,
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	commitFile(t, origin, "a.txt", "a")
+	monitor.checkRepository(repo)
+	makeRetryDue(t, repo)
+	monitor.checkRepository(repo)
+
+	retry := GetRepoState(repo).ScriptRetry
+	if retry == nil || retry.Status != ScriptRetryAbandoned || retry.Attempts != 2 {
+		t.Fatalf("Expected retries to be abandoned after 2 attempts, got %+v", retry)
+	}
+
+	// Abandoned retries don't run again
+	makeRetryDue(t, repo)
+	monitor.checkRepository(repo)
+	if got := GetRepoState(repo).ScriptRetry.Attempts; got != 2 {
+		t.Errorf("Abandoned retry ran again (attempts %d)", got)
+	}
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// Rollback puts repo back on a previously deployed commit, re-runs its
+// post-pull script and pins it so the monitor leaves it alone until Unpin.
+// target is a commit SHA or the number of deployments to go back ("" means 1).
+func (m *MonitorV2) Rollback(repo Repository, target string) (string, error) {
+	// Wait for a running check to finish and keep the daemon out until done
+	unlock, err := m.lockRepository(repo)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	sha, err := resolveRollbackTarget(repo, target)
+	if err != nil {
+		return "", err
+	}
+
+	// Pin first so a running daemon stops updating the repository
+	if err := UpdateRepoState(repo, func(s *RepoState) {
+		now := time.Now()
+		s.PinnedSHA = sha
+		s.PinnedAt = &now
+	}); err != nil {
+		return "", fmt.Errorf("failed to pin repository: %w", err)
+	}
+
+	repoLogger, err := logger.NewRepoLogger(repo.URL, repo.Path)
+	if err != nil {
+		logger.Error("Failed to create repository logger",
+			zap.String("repo", repo.URL),
+			zap.Error(err))
+	}
+	defer func() {
+		if repoLogger != nil {
+			repoLogger.Close()
+		}
+	}()
+
+	logInfo(repoLogger, repo, "Rolling back", zap.String("sha", sha))
+
+	deploy := newDeployment(repo, DeployKindRollback)
+	deploy.NewSHA = sha
+	if repo.Strategy == StrategyRelease {
+		deploy.OldSHA = currentReleaseSHA(repo)
+		err = m.rollbackRelease(repo, sha, deploy, repoLogger)
+	} else {
+		deploy.OldSHA, _ = runGit(repo.Path, "rev-parse", "HEAD")
+		err = m.rollbackInPlace(repo, sha, deploy, repoLogger)
+	}
+	m.finishDeployment(repo, deploy, err, repoLogger)
+	m.recordDeployment(deploy)
+	if err != nil {
+		logError(repoLogger, repo, "Rollback failed", zap.String("sha", sha), zap.Error(err))
+		return sha, err
+	}
+
+	logInfo(repoLogger, repo, "Rolled back and pinned", zap.String("sha", sha))
+	return sha, nil
+}
+
+// Unpin lets the monitor resume updating repo
+func Unpin(repo Repository) error {
+	return UpdateRepoState(repo, func(s *RepoState) {
+		s.PinnedSHA = ""
+		s.PinnedAt = nil
+	})
+}
+
+func (m *MonitorV2) rollbackInPlace(repo Repository, sha string, deploy *Deployment, repoLogger *logger.RepoLogger) error {
+	output, err := runGit(repo.Path, "reset", "--hard", sha)
+	deploy.PullOutput = output
+	if err != nil {
+		return err
+	}
+	if err := updateCheckoutExtras(repo, repo.Path); err != nil {
+		return err
+	}
+	if repo.PostPullScript != "" {
+		err := m.executePostPullScript(repo, deploy, repoLogger)
+		deploy.setScriptResult(err)
+		return err
+	}
+	return nil
+}
+
+func (m *MonitorV2) rollbackRelease(repo Repository, sha string, deploy *Deployment, repoLogger *logger.RepoLogger) error {
+	names, err := listReleases(repo)
+	if err != nil {
+		return err
+	}
+
+	// Prefer the newest existing release of sha; it already has shared links in place
+	for i := len(names) - 1; i >= 0; i-- {
+		releaseDir := filepath.Join(releasesDir(repo), names[i])
+		if releaseSHA, err := runGit(releaseDir, "rev-parse", "HEAD"); err != nil || releaseSHA != sha {
+			continue
+		}
+		if repo.PostPullScript != "" {
+			releaseRepo := repo
+			releaseRepo.Path = releaseDir
+			err := m.executePostPullScript(releaseRepo, deploy, repoLogger)
+			deploy.setScriptResult(err)
+			if err != nil {
+				return fmt.Errorf("release %s not activated: %w", names[i], err)
+			}
+		}
+		return switchCurrent(repo, names[i])
+	}
+
+	// The release was pruned, so build a fresh one
+	return m.deployRelease(repo, sha, deploy, repoLogger)
+}
+
+// resolveRollbackTarget turns a SHA or a step count into a full commit hash
+func resolveRollbackTarget(repo Repository, target string) (string, error) {
+	if target == "" {
+		target = "1"
+	}
+
+	if n, err := strconv.Atoi(target); err == nil && len(target) < 7 {
+		if n < 1 {
+			return "", fmt.Errorf("rollback steps must be at least 1")
+		}
+		previous, err := previousDeployments(repo)
+		if err != nil {
+			return "", err
+		}
+		if n > len(previous) {
+			return "", fmt.Errorf("only %d previous deployments available", len(previous))
+		}
+		return previous[n-1], nil
+	}
+
+	sha, err := runGit(gitDirFor(repo), "rev-parse", "--verify", target+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown commit %s", target)
+	}
+	return sha, nil
+}
+
+// previousDeployments lists previously deployed commits, newest first,
+// excluding the one currently deployed and commits rolled back from since
+// they were last deployed
+func previousDeployments(repo Repository) ([]string, error) {
+	var current string
+	var candidates []string
+
+	history, err := LoadHistory(HistoryFilter{Repo: repo.Path})
+	if err != nil {
+		return nil, err
+	}
+	rolledBack := map[string]bool{}
+	for _, d := range history {
+		// Rollbacks only revisit earlier deployments, and mark the commit they left as bad
+		if d.Kind == DeployKindRollback {
+			rolledBack[d.OldSHA] = true
+			continue
+		}
+		// Each successful deployment replaced OldSHA with NewSHA, so both
+		// were live, unless a later rollback left them
+		if d.Status == DeployStatusSuccess {
+			for _, sha := range []string{d.NewSHA, d.OldSHA} {
+				if !rolledBack[sha] {
+					candidates = append(candidates, sha)
+				}
+			}
+		}
+	}
+
+	if repo.Strategy == StrategyRelease {
+		current = currentReleaseSHA(repo)
+		if len(candidates) == 0 {
+			names, err := listReleases(repo)
+			if err != nil {
+				return nil, err
+			}
+			for i := len(names) - 1; i >= 0; i-- {
+				if sha, err := runGit(filepath.Join(releasesDir(repo), names[i]), "rev-parse", "HEAD"); err == nil {
+					candidates = append(candidates, sha)
+				}
+			}
+		}
+	} else {
+		current, _ = runGit(repo.Path, "rev-parse", "HEAD")
+		if len(candidates) == 0 {
+			// Without history, the reflog records every commit HEAD has been on
+			output, err := runGit(repo.Path, "reflog", "--format=%H")
+			if err != nil {
+				return nil, err
+			}
+			for _, sha := range strings.Fields(output) {
+				if !rolledBack[sha] {
+					candidates = append(candidates, sha)
+				}
+			}
+		}
+	}
+
+	seen := map[string]bool{"": true, current: true}
+	var previous []string
+	for _, sha := range candidates {
+		if !seen[sha] {
+			seen[sha] = true
+			previous = append(previous, sha)
+		}
+	}
+	return previous, nil
+}
+
+// gitDirFor returns the directory git commands should run in for repo
+func gitDirFor(repo Repository) string {
+	if repo.Strategy == StrategyRelease {
+		return releaseRepoDir(repo)
+	}
+	return repo.Path
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRollbackInPlace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	first := commitFile(t, origin, "deploy.sh", "#!/bin/sh\necho v1 > deployed.txt\n")
+
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "app"),
+		PostPullScript: "deploy.sh",
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	second := commitFile(t, origin, "deploy.sh", "#!/bin/sh\necho v2 > deployed.txt\n")
+	monitor.checkRepository(repo)
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != second {
+		t.Fatalf("Expected HEAD at %s after pull, got %s", second, head)
+	}
+
+	sha, err := monitor.Rollback(repo, "")
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if sha != first {
+		t.Errorf("Expected rollback to %s, got %s", first, sha)
+	}
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != first {
+		t.Errorf("Expected HEAD at %s after rollback, got %s", first, head)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo.Path, "deployed.txt")); string(data) != "v1\n" {
+		t.Errorf("Post-pull script was not re-run, deployed.txt = %q", data)
+	}
+
+	// A pinned repository must not be pulled forward again
+	monitor.checkRepository(repo)
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != first {
+		t.Errorf("Pinned repository was updated to %s", head)
+	}
+
+	if err := Unpin(repo); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	monitor.checkRepository(repo)
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != second {
+		t.Errorf("Expected HEAD back at %s after unpin, got %s", second, head)
+	}
+}
+
+func TestRollbackTwice(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	a := gitT(t, origin, "rev-parse", "HEAD")
+	repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app")}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	b := commitFile(t, origin, "index.html", "v2")
+	monitor.checkRepository(repo)
+	commitFile(t, origin, "index.html", "v3")
+	monitor.checkRepository(repo)
+
+	// Each rollback goes further back, never to the commit just left
+	for _, want := range []string{b, a} {
+		sha, err := monitor.Rollback(repo, "")
+		if err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+		if sha != want {
+			t.Fatalf("Expected rollback to %s, got %s", want, sha)
+		}
+	}
+	if _, err := monitor.Rollback(repo, ""); err == nil {
+		t.Error("Expected no earlier deployment to roll back to")
+	}
+}
+
+func TestRollbackRelease(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	first := gitT(t, origin, "rev-parse", "HEAD")
+
+	repo := Repository{
+		URL:      origin,
+		Branch:   "main",
+		Path:     filepath.Join(t.TempDir(), "site"),
+		Strategy: StrategyRelease,
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.checkRepository(repo)
+	commitFile(t, origin, "index.html", "v2")
+	monitor.checkRepository(repo)
+
+	if _, err := monitor.Rollback(repo, "1"); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if got := currentReleaseSHA(repo); got != first {
+		t.Errorf("Expected current release at %s, got %s", first, got)
+	}
+}
+
+func TestRollbackRejectsUnknownTarget(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app")}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60})
+	if _, err := monitor.Rollback(repo, "1"); err == nil {
+		t.Error("Expected error when there is no previous deployment")
+	}
+	if _, err := monitor.Rollback(repo, "deadbeefdeadbeef"); err == nil {
+		t.Error("Expected error for unknown commit")
+	}
+	if state := GetRepoState(repo); state.PinnedSHA != "" {
+		t.Error("Failed rollback should not pin the repository")
+	}
+}
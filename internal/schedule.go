@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// minCheckInterval is the shortest poll interval accepted, globally or per repository
+const minCheckInterval = 10
+
+// repoSchedule decides when a repository is checked next
+type repoSchedule struct {
+	interval time.Duration
+	cron     cron.Schedule
+	expr     string
+	jitter   time.Duration
+}
+
+// newRepoSchedule builds repo's schedule. A cron expression wins over an
+// interval, and a per-repository interval or jitter wins over the global one.
+func newRepoSchedule(config *Config, repo Repository) (*repoSchedule, error) {
+	s := &repoSchedule{
+		interval: time.Duration(config.CheckInterval) * time.Second,
+		jitter:   time.Duration(config.Jitter) * time.Second,
+	}
+	if repo.Interval > 0 {
+		s.interval = time.Duration(repo.Interval) * time.Second
+	}
+	if repo.Jitter > 0 {
+		s.jitter = time.Duration(repo.Jitter) * time.Second
+	}
+
+	if repo.Schedule != "" {
+		schedule, err := cron.ParseStandard(repo.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", repo.Schedule, err)
+		}
+		s.cron = schedule
+		s.expr = repo.Schedule
+	}
+	return s, nil
+}
+
+// next returns the time of the check after one finishing at now
+func (s *repoSchedule) next(now time.Time) time.Time {
+	var next time.Time
+	if s.cron != nil {
+		next = s.cron.Next(now)
+	} else {
+		next = now.Add(s.interval)
+	}
+	return next.Add(s.randomJitter())
+}
+
+// randomJitter returns a random delay up to the configured jitter
+func (s *repoSchedule) randomJitter() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.jitter) + 1))
+}
+
+func (s *repoSchedule) String() string {
+	desc := fmt.Sprintf("every %s", s.interval)
+	if s.cron != nil {
+		desc = fmt.Sprintf("cron %q", s.expr)
+	}
+	if s.jitter > 0 {
+		desc += fmt.Sprintf(" (jitter up to %s)", s.jitter)
+	}
+	return desc
+}
+
+// ValidateSchedule reports whether repo's cron expression can be parsed
+func ValidateSchedule(repo Repository) error {
+	if repo.Schedule == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(repo.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", repo.Schedule, err)
+	}
+	return nil
+}
+
+// DescribeSchedule returns a human readable description of when repo is checked
+func DescribeSchedule(config *Config, repo Repository) string {
+	s, err := newRepoSchedule(config, repo)
+	if err != nil {
+		return err.Error()
+	}
+	return s.String()
+}
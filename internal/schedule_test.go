@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepoScheduleNext(t *testing.T) {
+	config := &Config{CheckInterval: 60}
+	now := time.Date(2025, 1, 1, 10, 15, 30, 0, time.Local)
+
+	tests := []struct {
+		name string
+		repo Repository
+		want time.Time
+	}{
+		{"GlobalInterval", Repository{}, now.Add(time.Minute)},
+		{"RepoInterval", Repository{Interval: 15}, now.Add(15 * time.Second)},
+		{"Cron", Repository{Schedule: "0 * * * *"}, time.Date(2025, 1, 1, 11, 0, 0, 0, time.Local)},
+		{"CronDescriptor", Repository{Schedule: "@daily", Interval: 15}, time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newRepoSchedule(config, tt.repo)
+			if err != nil {
+				t.Fatalf("newRepoSchedule failed: %v", err)
+			}
+			if got := s.next(now); !got.Equal(tt.want) {
+				t.Errorf("next(%v) = %v, want %v", now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoScheduleJitter(t *testing.T) {
+	now := time.Now()
+	s, err := newRepoSchedule(&Config{CheckInterval: 60, Jitter: 300}, Repository{Jitter: 5})
+	if err != nil {
+		t.Fatalf("newRepoSchedule failed: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		delay := s.next(now).Sub(now)
+		if delay < time.Minute || delay > time.Minute+5*time.Second {
+			t.Fatalf("Expected next check within 60-65s, got %v", delay)
+		}
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	if err := ValidateSchedule(Repository{Schedule: "*/5 * * * *"}); err != nil {
+		t.Errorf("Expected valid cron expression, got %v", err)
+	}
+	if err := ValidateSchedule(Repository{Schedule: "every tuesday"}); err == nil {
+		t.Error("Expected error for invalid cron expression")
+	}
+}
+
+func TestDescribeSchedule(t *testing.T) {
+	config := &Config{CheckInterval: 60}
+
+	if got := DescribeSchedule(config, Repository{Interval: 15, Jitter: 5}); got != "every 15s (jitter up to 5s)" {
+		t.Errorf("Unexpected description: %q", got)
+	}
+	if got := DescribeSchedule(config, Repository{Schedule: "@hourly"}); !strings.Contains(got, "@hourly") {
+		t.Errorf("Expected cron expression in description, got %q", got)
+	}
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// scriptWaitDelay bounds how long we wait for output after a script exits,
+	// so background processes that inherit stdout can't hang the monitor
+	scriptWaitDelay = 5 * time.Second
+
+	// scriptTailLines is the number of output lines kept for error reports
+	scriptTailLines = 20
+)
+
+// errScriptTimeout is returned when a script exceeds its configured timeout
+var errScriptTimeout = errors.New("script timed out")
+
+// errInterrupted is returned when a script is killed because the daemon is shutting down
+var errInterrupted = errors.New("interrupted by shutdown")
+
+// ValidateScriptInterpreter checks that repo's script_interpreter, if set, names a command
+func ValidateScriptInterpreter(repo Repository) error {
+	if repo.ScriptInterpreter != "" && strings.TrimSpace(repo.ScriptInterpreter) == "" {
+		return fmt.Errorf("script_interpreter must not be blank")
+	}
+	return nil
+}
+
+// scriptCommand builds the command that runs scriptPath. A configured
+// interpreter wins; otherwise the script's shebang is honoured, falling back
+// to /bin/sh for scripts without one.
+func scriptCommand(ctx context.Context, scriptPath, interpreter string) (*exec.Cmd, error) {
+	if fields := strings.Fields(interpreter); len(fields) > 0 {
+		return exec.CommandContext(ctx, fields[0], append(fields[1:], scriptPath)...), nil
+	}
+
+	shebang, err := readShebang(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+	if shebang == nil {
+		return exec.CommandContext(ctx, "/bin/sh", scriptPath), nil
+	}
+
+	if info, err := os.Stat(scriptPath); err == nil && info.Mode()&0111 != 0 {
+		// Let the kernel honour the shebang exactly as a shell would
+		return exec.CommandContext(ctx, scriptPath), nil
+	}
+
+	// Not executable (e.g. lost the bit in git), so run the shebang interpreter ourselves
+	return exec.CommandContext(ctx, shebang[0], append(shebang[1:], scriptPath)...), nil
+}
+
+// readShebang returns the interpreter and arguments from a script's #! line, or nil
+func readShebang(scriptPath string) ([]string, error) {
+	f, err := os.Open(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return nil, nil
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// scriptEnv returns the environment for a script run on behalf of deploy
+func scriptEnv(repo Repository, deploy *Deployment) []string {
+	env := os.Environ()
+	env = append(env,
+		"SPDEPLOY_BRANCH="+repo.Branch,
+		"SPDEPLOY_REPO_URL="+repo.URL,
+	)
+	if deploy != nil {
+		env = append(env,
+			"SPDEPLOY_OLD_SHA="+deploy.OldSHA,
+			"SPDEPLOY_NEW_SHA="+deploy.NewSHA,
+			"SPDEPLOY_DEPLOY_ID="+deploy.ID,
+		)
+		if deploy.Tag != "" {
+			env = append(env, "SPDEPLOY_TAG="+deploy.Tag)
+		}
+	}
+	return env
+}
+
+// runScript runs cmd, calling onLine for every line of output as it is
+// produced. When cmd's context expires the whole process group is killed.
+// It returns the last few output lines for error reporting.
+func runScript(cmd *exec.Cmd, onLine func(stream, line string)) (string, error) {
+	tail := &outputTail{max: scriptTailLines}
+	stdout := &lineWriter{onLine: func(line string) { tail.add(line); onLine("stdout", line) }}
+	stderr := &lineWriter{onLine: func(line string) { tail.add(line); onLine("stderr", line) }}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = scriptWaitDelay
+
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+
+	return tail.String(), err
+}
+
+// lineWriter is an io.Writer that calls onLine for each complete line written
+type lineWriter struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	onLine func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.buf.Next(idx+1)), "\r\n")
+		w.onLine(line)
+	}
+	return len(p), nil
+}
+
+// Flush emits any trailing output that didn't end with a newline
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		w.onLine(strings.TrimRight(w.buf.String(), "\r\n"))
+		w.buf.Reset()
+	}
+}
+
+// outputTail keeps the last max lines of output
+type outputTail struct {
+	mu    sync.Mutex
+	max   int
+	lines []string
+}
+
+func (t *outputTail) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+func (t *outputTail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return strings.Join(t.lines, "\n")
+}
+
+// scriptContext returns a context derived from parent that expires after
+// timeout seconds, or only when parent is cancelled if timeout is zero
+func scriptContext(parent context.Context, timeout int) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, time.Duration(timeout)*time.Second)
+}
+
+// scriptError wraps a script failure, distinguishing timeouts and shutdown from other errors
+func scriptError(ctx context.Context, timeout int, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w after %ds: %w", errScriptTimeout, timeout, err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("%w: %w", errInterrupted, err)
+	}
+	return err
+}
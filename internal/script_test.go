@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScriptCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	write := func(name, content string, mode os.FileMode) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	ctx, cancel := scriptContext(context.Background(), 0)
+	defer cancel()
+
+	t.Run("ExecutableShebang", func(t *testing.T) {
+		path := write("exec.sh", "#!/bin/bash\necho hi\n", 0755)
+		cmd, err := scriptCommand(ctx, path, "")
+		if err != nil {
+			t.Fatalf("scriptCommand failed: %v", err)
+		}
+		if len(cmd.Args) != 1 || cmd.Args[0] != path {
+			t.Errorf("Expected script to be executed directly, got %v", cmd.Args)
+		}
+	})
+
+	t.Run("NonExecutableShebang", func(t *testing.T) {
+		path := write("noexec.sh", "#!/usr/bin/env python3 -u\nprint('hi')\n", 0644)
+		cmd, err := scriptCommand(ctx, path, "")
+		if err != nil {
+			t.Fatalf("scriptCommand failed: %v", err)
+		}
+		expected := []string{"/usr/bin/env", "python3", "-u", path}
+		if strings.Join(cmd.Args, " ") != strings.Join(expected, " ") {
+			t.Errorf("Expected %v, got %v", expected, cmd.Args)
+		}
+	})
+
+	t.Run("NoShebang", func(t *testing.T) {
+		path := write("plain.sh", "echo hi\n", 0644)
+		cmd, err := scriptCommand(ctx, path, "")
+		if err != nil {
+			t.Fatalf("scriptCommand failed: %v", err)
+		}
+		if cmd.Args[0] != "/bin/sh" {
+			t.Errorf("Expected /bin/sh fallback, got %v", cmd.Args)
+		}
+	})
+
+	t.Run("ConfiguredInterpreter", func(t *testing.T) {
+		path := write("custom.sh", "#!/bin/sh\necho hi\n", 0755)
+		cmd, err := scriptCommand(ctx, path, "bash -e")
+		if err != nil {
+			t.Fatalf("scriptCommand failed: %v", err)
+		}
+		if strings.Join(cmd.Args, " ") != "bash -e "+path {
+			t.Errorf("Expected configured interpreter, got %v", cmd.Args)
+		}
+	})
+
+	t.Run("BlankInterpreter", func(t *testing.T) {
+		path := write("blank.sh", "echo hi\n", 0644)
+		cmd, err := scriptCommand(ctx, path, "  \t")
+		if err != nil {
+			t.Fatalf("scriptCommand failed: %v", err)
+		}
+		if cmd.Args[0] != "/bin/sh" {
+			t.Errorf("Expected a blank interpreter to be ignored, got %v", cmd.Args)
+		}
+		if err := ValidateScriptInterpreter(Repository{ScriptInterpreter: "  \t"}); err == nil {
+			t.Error("Expected a blank interpreter to be rejected")
+		}
+	})
+}
+
+func TestExecutePostPullScriptEnvironment(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tmpDir := t.TempDir()
+
+	script := "#!/bin/sh\nenv | grep ^SPDEPLOY_ | sort > env.txt\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "deploy.sh"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	repo := Repository{
+		URL:            "git@github.com:test/repo.git",
+		Branch:         "main",
+		Path:           tmpDir,
+		PostPullScript: "deploy.sh",
+	}
+	deploy := newDeployment(repo, DeployKindDeploy)
+	deploy.OldSHA = "1111111"
+	deploy.NewSHA = "2222222"
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60})
+	if err := monitor.executePostPullScript(repo, deploy, nil); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "env.txt"))
+	if err != nil {
+		t.Fatalf("Script did not write env.txt: %v", err)
+	}
+	for _, expected := range []string{
+		"SPDEPLOY_BRANCH=main",
+		"SPDEPLOY_DEPLOY_ID=" + deploy.ID,
+		"SPDEPLOY_NEW_SHA=2222222",
+		"SPDEPLOY_OLD_SHA=1111111",
+		"SPDEPLOY_REPO_URL=git@github.com:test/repo.git",
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %q in script environment, got:\n%s", expected, data)
+		}
+	}
+}
+
+func TestRunScriptStreamsOutput(t *testing.T) {
+	ctx, cancel := scriptContext(context.Background(), 0)
+	defer cancel()
+
+	cmd, _ := scriptCommand(ctx, writeScript(t, "#!/bin/sh\necho one\necho two >&2\nprintf three\n"), "")
+
+	var mu sync.Mutex
+	var lines []string
+	_, err := runScript(cmd, func(stream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, stream+":"+line)
+	})
+	if err != nil {
+		t.Fatalf("runScript failed: %v", err)
+	}
+
+	got := strings.Join(lines, ",")
+	for _, expected := range []string{"stdout:one", "stderr:two", "stdout:three"} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Expected %q in streamed output, got %s", expected, got)
+		}
+	}
+}
+
+func TestRunScriptTimeoutKillsProcessGroup(t *testing.T) {
+	ctx, cancel := scriptContext(context.Background(), 1)
+	defer cancel()
+
+	// The background sleep holds stdout open; it must be killed with its parent
+	cmd, _ := scriptCommand(ctx, writeScript(t, "#!/bin/sh\nsleep 30 &\nsleep 30\n"), "")
+
+	start := time.Now()
+	_, err := runScript(cmd, func(stream, line string) {})
+	err = scriptError(ctx, 1, err)
+
+	if !errors.Is(err, errScriptTimeout) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Script was not killed promptly, took %s", elapsed)
+	}
+}
+
+func writeScript(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+const (
+	// defaultDeepenStep is how far a shallow checkout without depth, e.g.
+	// one cloned by hand, is deepened at a time
+	defaultDeepenStep = 50
+	// maxDeepenRounds bounds how often history is deepened, doubling the
+	// step each time, before HEAD is treated as diverged
+	maxDeepenRounds = 8
+)
+
+// ValidateDepthAndSparse checks repo's depth and sparse_paths
+func ValidateDepthAndSparse(repo Repository) error {
+	if repo.Depth < 0 {
+		return fmt.Errorf("depth must not be negative")
+	}
+	if len(repo.SparsePaths) == 0 {
+		return nil
+	}
+	if repo.Strategy == StrategyRelease {
+		return fmt.Errorf("sparse_paths is not supported with the release strategy")
+	}
+	for _, p := range repo.SparsePaths {
+		dir := strings.Trim(p, "/")
+		if dir == "" || strings.HasPrefix(dir, "-") || strings.ContainsAny(dir, "*?[\\") || slices.Contains(strings.Split(dir, "/"), "..") {
+			return fmt.Errorf("invalid sparse path %q (use directories relative to the repository root)", p)
+		}
+	}
+	return nil
+}
+
+// depthArgs returns the git flags limiting history to repo's depth. Deploy
+// paths on a shared mirror borrow its objects, so depth would save nothing.
+func depthArgs(repo Repository) []string {
+	if repo.Depth <= 0 || usesMirror(repo) {
+		return nil
+	}
+	return []string{"--depth", strconv.Itoa(repo.Depth)}
+}
+
+// withArgs inserts extra right after the git subcommand in args
+func withArgs(args []string, extra ...string) []string {
+	return append(append([]string{args[0]}, extra...), args[1:]...)
+}
+
+// sparseDirs returns repo's sparse_paths as git sparse-checkout lists them
+func sparseDirs(repo Repository) []string {
+	var dirs []string
+	for _, p := range repo.SparsePaths {
+		dirs = append(dirs, strings.Trim(p, "/"))
+	}
+	return dirs
+}
+
+// applySparsePaths makes the checkout in dir contain only repo's
+// sparse_paths, plus files at the repository root, or everything when none
+// are set. It does nothing when the checkout already matches.
+func applySparsePaths(repo Repository, dir string) error {
+	if !usesExec(repo) {
+		return nil
+	}
+	enabled, _ := runGit(dir, "config", "--bool", "core.sparseCheckout")
+	want := sparseDirs(repo)
+	if len(want) == 0 {
+		if enabled == "true" {
+			if _, err := runGit(dir, "sparse-checkout", "disable"); err != nil {
+				return fmt.Errorf("failed to disable sparse checkout: %w", err)
+			}
+		}
+		return nil
+	}
+
+	if enabled == "true" {
+		current, err := runGit(dir, "sparse-checkout", "list")
+		if err == nil {
+			have := strings.Fields(current)
+			slices.Sort(have)
+			sorted := slices.Sorted(slices.Values(want))
+			if slices.Equal(have, sorted) {
+				return nil
+			}
+		}
+	}
+	if _, err := runGit(dir, append([]string{"sparse-checkout", "set", "--cone"}, want...)...); err != nil {
+		return fmt.Errorf("failed to set sparse paths: %w", err)
+	}
+	return nil
+}
+
+// deepenTo makes sure the shallow history of target in dir reaches base,
+// the deployed commit. A shallow fetch of more new commits than its depth
+// stops short of base, and without the commits in between git can't tell
+// target descends from it: ahead counts come out wrong and the update looks
+// like a force push. History is deepened until base is found, the full
+// history is fetched, or maxDeepenRounds is reached; base really isn't an
+// ancestor in the last two cases.
+func deepenTo(repo Repository, dir, base, target string, repoLogger *logger.RepoLogger) error {
+	if !usesExec(repo) {
+		return nil
+	}
+	if shallow, _ := runGit(dir, "rev-parse", "--is-shallow-repository"); shallow != "true" {
+		return nil
+	}
+
+	step := repo.Depth
+	if step <= 0 {
+		step = defaultDeepenStep
+	}
+	for round := 0; round < maxDeepenRounds; round++ {
+		if _, err := runGit(dir, "merge-base", "--is-ancestor", base, target); err == nil {
+			return nil
+		}
+
+		before, err := runGit(dir, "rev-list", "--count", target)
+		if err != nil {
+			return fmt.Errorf("failed to count commits of %s: %w", target, err)
+		}
+		logInfo(repoLogger, repo, "Deepening shallow history to reach the deployed commit",
+			zap.Int("deepen", step),
+			zap.String("commits", before))
+		args := withArgs(fetchArgs(repo), "--deepen", strconv.Itoa(step))
+		if _, err := runRemoteGit(repo, dir, args...); err != nil {
+			return fmt.Errorf("failed to deepen shallow history: %w", err)
+		}
+		if after, _ := runGit(dir, "rev-list", "--count", target); after == before {
+			// The whole history is here, so HEAD is genuinely not an ancestor
+			return nil
+		}
+		step *= 2
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateDepthAndSparse(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    Repository
+		wantErr bool
+	}{
+		{"none", Repository{}, false},
+		{"depth", Repository{Depth: 1, SparsePaths: []string{"deploy/", "config/nginx"}}, false},
+		{"negative depth", Repository{Depth: -1}, true},
+		{"glob", Repository{SparsePaths: []string{"deploy/*"}}, true},
+		{"parent", Repository{SparsePaths: []string{"../etc"}}, true},
+		{"root", Repository{SparsePaths: []string{"/"}}, true},
+		{"release", Repository{Strategy: StrategyRelease, SparsePaths: []string{"deploy"}}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateDepthAndSparse(tt.repo); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateDepthAndSparse() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := ValidateGitBackend(Repository{GitBackend: GitBackendGoGit, Depth: 1}, ""); err == nil {
+		t.Error("Expected the go-git backend to reject depth")
+	}
+}
+
+func TestShallowUpdate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	commitFile(t, origin, "index.html", "v2")
+	// Git ignores depth for plain local paths
+	repo := Repository{URL: "file://" + filepath.ToSlash(origin), Branch: "main", Path: filepath.Join(t.TempDir(), "app"), Depth: 1}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	if count := gitT(t, repo.Path, "rev-list", "--count", "HEAD"); count != "1" {
+		t.Fatalf("Expected a clone of depth 1, got %s commits", count)
+	}
+
+	// More new commits than the depth fetches
+	var head string
+	for _, content := range []string{"v3", "v4", "v5"} {
+		head = commitFile(t, origin, "index.html", content)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.checkRepository(repo)
+
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+	if len(history) != 1 || history[0].Status != DeployStatusSuccess {
+		t.Fatalf("Expected a successful deployment, got %+v", history)
+	}
+	if history[0].CommitCount != 3 {
+		t.Errorf("Expected 3 new commits, got %d", history[0].CommitCount)
+	}
+	if got := gitT(t, repo.Path, "rev-parse", "HEAD"); got != head {
+		t.Errorf("Expected HEAD at %s, got %s", head, got)
+	}
+}
+
+func TestSparsePaths(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	commitFile(t, origin, "deploy/run.sh", "run")
+	commitFile(t, origin, "docs/guide.md", "guide")
+	repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app"), SparsePaths: []string{"deploy/"}}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(repo.Path, name))
+		return err == nil
+	}
+	if !exists("index.html") || !exists("deploy/run.sh") || exists("docs/guide.md") {
+		t.Fatal("Expected only root files and deploy/ to be checked out")
+	}
+
+	// Changing sparse_paths applies on the next check
+	repo.SparsePaths = []string{"docs"}
+	commitFile(t, origin, "index.html", "v2")
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.checkRepository(repo)
+	if exists("deploy/run.sh") || !exists("docs/guide.md") {
+		t.Error("Expected the new sparse paths to be checked out")
+	}
+	if content, _ := os.ReadFile(filepath.Join(repo.Path, "index.html")); string(content) != "v2" {
+		t.Errorf("Expected the update to be deployed, got %q", content)
+	}
+
+	repo.SparsePaths = nil
+	monitor.checkRepository(repo)
+	if !exists("deploy/run.sh") {
+		t.Error("Expected the full checkout once sparse_paths is removed")
+	}
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// Shutdown stops scheduling checks and waits up to the configured grace
+// period for running ones to finish, then kills the process groups of any
+// scripts still running. Run returns once Shutdown completes.
+func (m *MonitorV2) Shutdown() {
+	m.shutdownMu.Lock()
+	if m.shuttingDown {
+		m.shutdownMu.Unlock()
+		<-m.stopped
+		return
+	}
+	m.shuttingDown = true
+	server := m.webhookServer
+	m.shutdownMu.Unlock()
+
+	grace := m.currentConfig().ShutdownGracePeriod()
+	logger.Info("Shutting down, waiting for running checks", zap.Duration("grace_period", grace))
+
+	close(m.done)
+	if server != nil {
+		server.Close()
+	}
+	m.cancelPollers()
+
+	finished := make(chan struct{})
+	go func() {
+		m.checks.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(grace):
+		logger.Warn("Shutdown grace period expired, killing running scripts")
+		m.killScripts()
+		select {
+		case <-finished:
+		case <-time.After(scriptWaitDelay + time.Second):
+			// Their in-progress markers stay in the state file for the next start
+			logger.Warn("Checks still running at exit; they will be reported as interrupted on the next start")
+		}
+	}
+	m.killScripts()
+	m.watching.Wait()
+
+	logger.Info("Shutdown complete")
+	logger.GetLogger().Sync()
+	close(m.stopped)
+}
+
+// ShutdownGracePeriod returns how long running checks get to finish on shutdown
+func (c *Config) ShutdownGracePeriod() time.Duration {
+	if c.ShutdownGrace > 0 {
+		return time.Duration(c.ShutdownGrace) * time.Second
+	}
+	return defaultShutdownGrace * time.Second
+}
+
+// beginCheck registers a running check, or returns false if the monitor is shutting down
+func (m *MonitorV2) beginCheck() bool {
+	m.shutdownMu.RLock()
+	defer m.shutdownMu.RUnlock()
+
+	if m.shuttingDown {
+		return false
+	}
+	m.checks.Add(1)
+	return true
+}
+
+func (m *MonitorV2) isShuttingDown() bool {
+	m.shutdownMu.RLock()
+	defer m.shutdownMu.RUnlock()
+	return m.shuttingDown
+}
+
+// recoverInterrupted reports deployments the previous daemon didn't finish
+// and arranges for their post-pull scripts to run again straight away
+func (m *MonitorV2) recoverInterrupted(config *Config) {
+	for _, repo := range config.Repositories {
+		state := GetRepoState(repo)
+		if state.InProgress != nil {
+			m.recordInterrupted(repo, state.InProgress)
+			continue
+		}
+
+		// A script killed by the last shutdown shouldn't wait out its retry backoff
+		retry := state.ScriptRetry
+		if state.Interrupted != nil && retry != nil && retry.Status == ScriptRetryPending &&
+			retry.SHA == state.Interrupted.NewSHA && !retry.Due(time.Now()) {
+			UpdateRepoState(repo, func(s *RepoState) {
+				if s.ScriptRetry != nil {
+					s.ScriptRetry.NextAttempt = time.Time{}
+				}
+			})
+		}
+	}
+}
+
+// recordInterrupted records a deployment left in progress by a previous daemon
+func (m *MonitorV2) recordInterrupted(repo Repository, marker *DeployMarker) {
+	logger.Warn("Previous deployment was interrupted",
+		zap.String("repo", repo.URL),
+		zap.String("path", repo.Path),
+		zap.String("deploy_id", marker.ID),
+		zap.String("new_sha", marker.NewSHA))
+
+	RecordDeployment(&Deployment{
+		ID:        marker.ID,
+		Kind:      marker.Kind,
+		Repo:      repo.URL,
+		Path:      stateKey(repo),
+		Branch:    repo.Branch,
+		OldSHA:    marker.OldSHA,
+		NewSHA:    marker.NewSHA,
+		Status:    DeployStatusInterrupted,
+		Error:     "daemon stopped before the deployment finished",
+		StartedAt: marker.StartedAt,
+	})
+
+	var head string
+	if repo.Strategy != StrategyRelease {
+		// A git process killed mid-pull leaves its lock behind and blocks every later pull
+		lock := filepath.Join(repo.Path, ".git", "index.lock")
+		if fileExists(lock) {
+			if err := os.Remove(lock); err != nil {
+				logger.Warn("Failed to remove stale index.lock", zap.String("path", lock), zap.Error(err))
+			} else {
+				logger.Warn("Removed stale index.lock", zap.String("path", lock))
+			}
+		}
+		head, _ = backendFor(repo).Resolve(repo.Path, "HEAD")
+	}
+
+	UpdateRepoState(repo, func(s *RepoState) {
+		s.InProgress = nil
+		s.Interrupted = marker
+
+		// The new commit is checked out but its script may not have finished,
+		// so treat it like a failed script. Releases redeploy on their own
+		// because current was never switched.
+		if head == "" || head != marker.NewSHA || repo.PostPullScript == "" {
+			return
+		}
+		if s.ScriptRetry == nil || s.ScriptRetry.SHA != head || s.ScriptRetry.Status != ScriptRetryPending {
+			s.ScriptRetry = &ScriptRetry{SHA: head, Status: ScriptRetryPending, Attempts: 1}
+		}
+		s.ScriptRetry.LastError = errInterrupted.Error()
+		s.ScriptRetry.LastAttempt = marker.StartedAt
+		s.ScriptRetry.NextAttempt = time.Time{}
+	})
+}
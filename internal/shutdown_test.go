@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newShutdownTestRepo returns a deployed repository whose script is script,
+// with one new commit waiting upstream
+func newShutdownTestRepo(t *testing.T, script string) Repository {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	commitFile(t, origin, "deploy.sh", script)
+
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "app"),
+		PostPullScript: "deploy.sh",
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	commitFile(t, origin, "a.txt", "a")
+	return repo
+}
+
+// waitForFile waits up to five seconds for path to appear
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !fileExists(path) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestShutdownWaitsForRunningDeploy(t *testing.T) {
+	markers := t.TempDir()
+	started, finished := filepath.Join(markers, "started"), filepath.Join(markers, "finished")
+	repo := newShutdownTestRepo(t, "#!/bin/sh\ntouch "+started+"\nsleep 1\ntouch "+finished+"\n")
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, ShutdownGrace: 10, Repositories: []Repository{repo}})
+	go monitor.checkRepository(repo)
+	waitForFile(t, started)
+
+	if state := GetRepoState(repo); state.InProgress == nil {
+		t.Error("Expected the running deployment to be marked in progress")
+	}
+
+	monitor.Shutdown()
+
+	if !fileExists(finished) {
+		t.Error("Shutdown returned before the running deploy finished")
+	}
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+	if len(history) != 1 || history[0].Status != DeployStatusSuccess {
+		t.Errorf("Expected successful deployment in history, got %+v", history)
+	}
+	if state := GetRepoState(repo); state.InProgress != nil || state.Interrupted != nil {
+		t.Errorf("Expected no in-progress or interrupted deployment, got %+v", state)
+	}
+
+	// No new checks start once shut down
+	commitFile(t, repo.URL, "b.txt", "b")
+	before := gitT(t, repo.Path, "rev-parse", "HEAD")
+	monitor.checkRepository(repo)
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != before {
+		t.Error("Check ran after shutdown")
+	}
+}
+
+func TestShutdownKillsScriptsAfterGrace(t *testing.T) {
+	started := filepath.Join(t.TempDir(), "started")
+	repo := newShutdownTestRepo(t, "#!/bin/sh\ntouch "+started+"\nsleep 30\n")
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, ShutdownGrace: 1, Repositories: []Repository{repo}})
+	go monitor.checkRepository(repo)
+	waitForFile(t, started)
+
+	begin := time.Now()
+	monitor.Shutdown()
+	if elapsed := time.Since(begin); elapsed > 10*time.Second {
+		t.Errorf("Shutdown took %v, expected the script to be killed after the grace period", elapsed)
+	}
+
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+	if len(history) != 1 || history[0].Status != DeployStatusInterrupted {
+		t.Fatalf("Expected interrupted deployment in history, got %+v", history)
+	}
+
+	state := GetRepoState(repo)
+	if state.InProgress != nil {
+		t.Error("Expected in-progress marker to be cleared")
+	}
+	if state.Interrupted == nil || state.Interrupted.ID != history[0].ID {
+		t.Errorf("Expected interrupted deployment in state, got %+v", state.Interrupted)
+	}
+	if state.ScriptRetry == nil || state.ScriptRetry.Status != ScriptRetryPending {
+		t.Errorf("Expected the killed script to be retried, got %+v", state.ScriptRetry)
+	}
+}
+
+func TestRecoverInterrupted(t *testing.T) {
+	repo := newShutdownTestRepo(t, "#!/bin/sh\nexit 0\n")
+
+	// Simulate a daemon killed after pulling but before the script finished
+	oldSHA := gitT(t, repo.Path, "rev-parse", "HEAD")
+	gitT(t, repo.Path, "pull", "origin", "main")
+	newSHA := gitT(t, repo.Path, "rev-parse", "HEAD")
+	marker := &DeployMarker{ID: "interrupted-1", Kind: DeployKindDeploy, OldSHA: oldSHA, NewSHA: newSHA, StartedAt: time.Now()}
+	UpdateRepoState(repo, func(s *RepoState) { s.InProgress = marker })
+	lock := filepath.Join(repo.Path, ".git", "index.lock")
+	os.WriteFile(lock, nil, 0644)
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.recoverInterrupted(monitor.currentConfig())
+
+	if fileExists(lock) {
+		t.Error("Expected stale index.lock to be removed")
+	}
+	state := GetRepoState(repo)
+	if state.InProgress != nil || state.Interrupted == nil || state.Interrupted.ID != marker.ID {
+		t.Errorf("Expected marker to move to interrupted, got %+v", state)
+	}
+	if !state.ScriptRetry.Due(time.Now()) || state.ScriptRetry.SHA != newSHA {
+		t.Errorf("Expected an immediate script retry for %s, got %+v", newSHA, state.ScriptRetry)
+	}
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path})
+	if len(history) != 1 || history[0].ID != marker.ID || history[0].Status != DeployStatusInterrupted {
+		t.Errorf("Expected interrupted deployment in history, got %+v", history)
+	}
+
+	// The next check re-runs the script and clears the interruption
+	monitor.checkRepository(repo)
+	state = GetRepoState(repo)
+	if state.Interrupted != nil || state.ScriptRetry == nil || state.ScriptRetry.Status != ScriptRetrySucceeded {
+		t.Errorf("Expected the retried script to succeed, got %+v", state)
+	}
+}
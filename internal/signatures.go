@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// Signature requirements, set with require_signed
+const (
+	// SignedTip requires the commit being deployed to be signed
+	SignedTip = "tip"
+	// SignedAll requires every incoming commit to be signed
+	SignedAll = "all"
+)
+
+// SignedModes lists every supported require_signed value
+var SignedModes = []string{SignedTip, SignedAll}
+
+var errUnverified = errors.New("commit signature not verified")
+
+// SignatureState records an update refused because a commit's signature
+// couldn't be verified
+type SignatureState struct {
+	SHA    string    `json:"sha"`
+	Commit string    `json:"commit"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+}
+
+// ValidateSignedPolicy checks repo's require_signed and the files its
+// signatures are verified against
+func ValidateSignedPolicy(repo Repository) error {
+	if repo.RequireSigned == "" {
+		return nil
+	}
+	if repo.RequireSigned != SignedTip && repo.RequireSigned != SignedAll {
+		return fmt.Errorf("unknown require_signed %q (use %s)", repo.RequireSigned, strings.Join(SignedModes, " or "))
+	}
+	if repo.AllowedSigners == "" && repo.GPGKeyring == "" {
+		return fmt.Errorf("require_signed needs allowed_signers or gpg_keyring")
+	}
+	for _, file := range []string{repo.AllowedSigners, repo.GPGKeyring} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("cannot read %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// verifySignatures checks the signatures of the commits repo would move to
+// from oldSHA to newSHA in dir. It returns an error wrapping errUnverified
+// for a commit without a valid signature from an allowed signer, and any
+// other error when verification itself couldn't run.
+func verifySignatures(repo Repository, dir, oldSHA, newSHA string) error {
+	if repo.RequireSigned == "" {
+		return nil
+	}
+
+	commits := []string{newSHA}
+	// Without a previous deployment there is no range, only the tip
+	if repo.RequireSigned == SignedAll && oldSHA != "" {
+		output, err := runGit(dir, "rev-list", oldSHA+".."+newSHA)
+		if err != nil {
+			return fmt.Errorf("failed to list incoming commits: %w", err)
+		}
+		commits = strings.Fields(output)
+	}
+
+	gnupgHome, err := gpgHome(repo)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(gnupgHome)
+
+	for _, sha := range commits {
+		if err := verifyCommit(repo, dir, gnupgHome, sha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gpgHome returns a fresh GnuPG home holding only repo's gpg_keyring, so a
+// GPG signature is only accepted from those keys and never from the
+// user's own keyring. The caller removes it.
+func gpgHome(repo Repository) (string, error) {
+	dir, err := os.MkdirTemp("", "spdeploy-gnupg-")
+	if err != nil {
+		return "", err
+	}
+	if repo.GPGKeyring == "" {
+		return dir, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout(&repo))
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "gpg", "--batch", "--quiet", "--import", repo.GPGKeyring)
+	cmd.Env = append(os.Environ(), "GNUPGHOME="+dir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to import %s: %w: %s", repo.GPGKeyring, err, strings.TrimSpace(string(output)))
+	}
+	return dir, nil
+}
+
+// signatureError is a commit whose signature couldn't be verified
+type signatureError struct {
+	SHA    string
+	Reason string
+}
+
+func (e *signatureError) Error() string {
+	return fmt.Sprintf("%v: commit %s: %s", errUnverified, shortSHA(e.SHA), e.Reason)
+}
+
+func (e *signatureError) Unwrap() error { return errUnverified }
+
+// verifyCommit runs git verify-commit for sha. SSH signatures are checked
+// against allowed_signers, GPG signatures against the keys in gnupgHome.
+func verifyCommit(repo Repository, dir, gnupgHome, sha string) error {
+	allowedSigners := repo.AllowedSigners
+	if allowedSigners == "" {
+		allowedSigners = os.DevNull
+	}
+	args := []string{"-c", "gpg.ssh.allowedSignersFile=" + allowedSigners, "verify-commit", sha}
+	cmd := newGitCmd(gitTimeout(&repo), dir, args...)
+	cmd.Env = append(cmd.Env, "GNUPGHOME="+gnupgHome)
+
+	output, err := runGitCmd(cmd, args[2:])
+	if err == nil || errors.Is(err, errGitTimeout) {
+		return err
+	}
+	// gpg and ssh-keygen explain the failure last
+	reason := "no signature"
+	if lines := strings.Split(output, "\n"); output != "" {
+		reason = strings.TrimSpace(lines[len(lines)-1])
+	}
+	return &signatureError{SHA: sha, Reason: reason}
+}
+
+// reportUnverified refuses an update whose commits failed verification with
+// err. Like a conflict, the refusal is recorded once per commit as a
+// rejected deployment and kept in the state file until an update succeeds.
+func (m *MonitorV2) reportUnverified(repo Repository, oldSHA, newSHA, tag string, err error, repoLogger *logger.RepoLogger) {
+	if prev := GetRepoState(repo).Unverified; prev != nil && prev.SHA == newSHA {
+		logWarn(repoLogger, repo, "Update still refused, commit signature not verified",
+			zap.String("new_sha", newSHA),
+			zap.Error(err))
+		return
+	}
+
+	logError(repoLogger, repo, "Security: refusing to deploy commits without a valid signature",
+		zap.String("event", "security"),
+		zap.String("require_signed", repo.RequireSigned),
+		zap.String("old_sha", oldSHA),
+		zap.String("new_sha", newSHA),
+		zap.Error(err))
+
+	deploy := newDeployment(repo, DeployKindDeploy)
+	deploy.Tag = tag
+	deploy.OldSHA = oldSHA
+	deploy.NewSHA = newSHA
+	deploy.CommitCount = countCommits(repo, gitDirFor(repo), oldSHA, newSHA)
+	m.finishDeployment(repo, deploy, err, repoLogger)
+	m.recordDeployment(deploy)
+
+	if err := UpdateRepoState(repo, func(s *RepoState) {
+		s.Unverified = &SignatureState{SHA: newSHA, Reason: err.Error(), Since: deploy.StartedAt}
+		var sigErr *signatureError
+		if errors.As(err, &sigErr) {
+			s.Unverified.Commit = sigErr.SHA
+		}
+	}); err != nil {
+		logWarn(repoLogger, repo, "Failed to save signature state", zap.Error(err))
+	}
+}
@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// signedCommit commits name with content in dir, signed by the git config in sign
+func signedCommit(t *testing.T, dir, name, content string, sign ...string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	gitT(t, dir, "add", ".")
+	gitT(t, dir, append(sign, "commit", "-S", "-m", "Update "+name)...)
+	return gitT(t, dir, "rev-parse", "HEAD")
+}
+
+// newSSHSigner generates an SSH key and returns the git config that signs with it
+func newSSHSigner(t *testing.T, dir, name string) (pub string, sign []string) {
+	t.Helper()
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found in PATH")
+	}
+	key := filepath.Join(dir, name)
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen failed: %v\n%s", err, output)
+	}
+	data, _ := os.ReadFile(key + ".pub")
+	return string(data), []string{"-c", "gpg.format=ssh", "-c", "user.signingkey=" + key + ".pub"}
+}
+
+func TestValidateSignedPolicy(t *testing.T) {
+	signers := filepath.Join(t.TempDir(), "allowed_signers")
+	os.WriteFile(signers, nil, 0644)
+
+	tests := []struct {
+		name    string
+		repo    Repository
+		wantErr bool
+	}{
+		{"Off", Repository{}, false},
+		{"Tip", Repository{RequireSigned: SignedTip, AllowedSigners: signers}, false},
+		{"All", Repository{RequireSigned: SignedAll, GPGKeyring: signers}, false},
+		{"Unknown", Repository{RequireSigned: "some", AllowedSigners: signers}, true},
+		{"NoKeys", Repository{RequireSigned: SignedTip}, true},
+		{"MissingFile", Repository{RequireSigned: SignedTip, AllowedSigners: signers + ".missing"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSignedPolicy(tt.repo); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSignedPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireSignedSSH(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	keys := t.TempDir()
+	pub, trusted := newSSHSigner(t, keys, "trusted")
+	_, stranger := newSSHSigner(t, keys, "stranger")
+	signers := filepath.Join(keys, "allowed_signers")
+	os.WriteFile(signers, []byte("deploy@example.com "+pub), 0644)
+
+	origin := newTestOrigin(t)
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "app"),
+		RequireSigned:  SignedAll,
+		AllowedSigners: signers,
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	latest := func() Deployment {
+		t.Helper()
+		history, _ := LoadHistory(HistoryFilter{Repo: repo.Path})
+		if len(history) == 0 {
+			t.Fatal("Expected a deployment in history")
+		}
+		return history[0]
+	}
+
+	head := signedCommit(t, origin, "index.html", "v2", trusted...)
+	monitor.checkRepository(repo)
+	if d := latest(); d.Status != DeployStatusSuccess || d.NewSHA != head {
+		t.Fatalf("Expected the signed commit to deploy, got %+v", d)
+	}
+
+	// An unsigned commit below a signed tip is refused in all mode
+	before := head
+	commitFile(t, origin, "index.html", "unsigned")
+	head = signedCommit(t, origin, "index.html", "v3", trusted...)
+	monitor.checkRepository(repo)
+	if d := latest(); d.Status != DeployStatusRejected || d.NewSHA != head {
+		t.Fatalf("Expected a rejected deployment, got %+v", d)
+	}
+	if sha := gitT(t, repo.Path, "rev-parse", "HEAD"); sha != before {
+		t.Errorf("Rejected update moved HEAD to %s", sha)
+	}
+	if s := GetRepoState(repo).Unverified; s == nil || s.SHA != head || s.Commit == "" {
+		t.Errorf("Expected the refusal in the state file, got %+v", s)
+	}
+
+	// The refusal is recorded once
+	monitor.checkRepository(repo)
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path})
+	if len(history) != 2 {
+		t.Errorf("Expected 2 deployments after a repeated check, got %d", len(history))
+	}
+
+	// Only the tip matters in tip mode, but it must be from an allowed signer
+	repo.RequireSigned = SignedTip
+	head = signedCommit(t, origin, "index.html", "v4", stranger...)
+	monitor.checkRepository(repo)
+	if d := latest(); d.Status != DeployStatusRejected || d.NewSHA != head {
+		t.Fatalf("Expected a commit from an unknown key to be rejected, got %+v", d)
+	}
+
+	head = signedCommit(t, origin, "index.html", "v5", trusted...)
+	monitor.checkRepository(repo)
+	if d := latest(); d.Status != DeployStatusSuccess || d.NewSHA != head {
+		t.Fatalf("Expected a signed tip to deploy, got %+v", d)
+	}
+	if s := GetRepoState(repo).Unverified; s != nil {
+		t.Errorf("Expected the refusal to be cleared, got %+v", s)
+	}
+}
+
+func TestRequireSignedGPG(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found in PATH")
+	}
+	t.Setenv("HOME", t.TempDir())
+
+	// The signing key lives in the test's own GnuPG home; the daemon only sees the exported keyring
+	gnupgHome, err := os.MkdirTemp("", "gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GNUPGHOME", gnupgHome)
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--kill", "all").Run()
+		os.RemoveAll(gnupgHome)
+	})
+	for _, uid := range []string{"Deploy <deploy@example.com>", "Stranger <stranger@example.com>"} {
+		cmd := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", uid, "ed25519", "sign", "never")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("gpg can't generate keys here: %v\n%s", err, output)
+		}
+	}
+	keyring := filepath.Join(t.TempDir(), "keyring.asc")
+	output, err := exec.Command("gpg", "--batch", "--armor", "--export", "deploy@example.com").Output()
+	if err != nil {
+		t.Fatalf("gpg --export failed: %v", err)
+	}
+	os.WriteFile(keyring, output, 0644)
+
+	origin := newTestOrigin(t)
+	repo := Repository{
+		URL:           origin,
+		Branch:        "main",
+		Path:          filepath.Join(t.TempDir(), "app"),
+		RequireSigned: SignedTip,
+		GPGKeyring:    keyring,
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	head := signedCommit(t, origin, "index.html", "v2", "-c", "user.signingkey=stranger@example.com")
+	monitor.checkRepository(repo)
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+	if len(history) != 1 || history[0].Status != DeployStatusRejected || history[0].NewSHA != head {
+		t.Fatalf("Expected a key outside the keyring to be rejected, got %+v", history)
+	}
+
+	head = signedCommit(t, origin, "index.html", "v3", "-c", "user.signingkey=deploy@example.com")
+	monitor.checkRepository(repo)
+	history, _ = LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+	if len(history) != 1 || history[0].Status != DeployStatusSuccess || history[0].NewSHA != head {
+		t.Fatalf("Expected a commit signed by the keyring to deploy, got %+v", history)
+	}
+}
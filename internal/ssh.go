@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Values accepted for Repository.StrictHostKeyChecking, passed through to ssh
+var strictHostKeyCheckingValues = []string{"yes", "no", "accept-new"}
+
+// validateSSHOptions checks the SSH settings of repo that don't depend on the filesystem
+func validateSSHOptions(repo Repository) error {
+	if repo.StrictHostKeyChecking != "" && !slices.Contains(strictHostKeyCheckingValues, repo.StrictHostKeyChecking) {
+		return fmt.Errorf("strict_host_key_checking must be one of %s", strings.Join(strictHostKeyCheckingValues, ", "))
+	}
+	return nil
+}
+
+// CheckSSHIdentity verifies that repo's SSH key and known_hosts file exist and
+// that the key is private to its owner, which ssh itself insists on
+func CheckSSHIdentity(repo Repository) error {
+	if err := validateSSHOptions(repo); err != nil {
+		return err
+	}
+
+	if repo.SSHKey != "" {
+		info, err := os.Stat(expandHome(repo.SSHKey))
+		if err != nil {
+			return fmt.Errorf("SSH key %s: %w", repo.SSHKey, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("SSH key %s is not a regular file", repo.SSHKey)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+			return fmt.Errorf("SSH key %s is accessible by other users (chmod 600)", repo.SSHKey)
+		}
+	}
+	if repo.KnownHosts != "" && !fileExists(expandHome(repo.KnownHosts)) {
+		return fmt.Errorf("known_hosts file %s does not exist", repo.KnownHosts)
+	}
+	return nil
+}
+
+// sshCommand returns the GIT_SSH_COMMAND for repo. It builds on the daemon
+// user's SSH setup, adding repo's key and host key settings and batch mode,
+// so a missing key or unknown host fails instead of waiting for input.
+func sshCommand(repo Repository) string {
+	var opts []string
+	if repo.SSHKey != "" {
+		// IdentitiesOnly stops ssh offering agent keys first, which would
+		// authenticate as another repository's deploy key
+		opts = append(opts, "-i", shellQuote(expandHome(repo.SSHKey)), "-o", "IdentitiesOnly=yes")
+	}
+	if repo.KnownHosts != "" {
+		opts = append(opts, "-o", shellQuote("UserKnownHostsFile="+expandHome(repo.KnownHosts)))
+	}
+	if repo.StrictHostKeyChecking != "" {
+		opts = append(opts, "-o", "StrictHostKeyChecking="+repo.StrictHostKeyChecking)
+	}
+	opts = append(opts, "-o", "BatchMode=yes")
+
+	base := os.Getenv("GIT_SSH_COMMAND")
+	if base == "" {
+		base = "ssh"
+	}
+	return base + " " + strings.Join(opts, " ")
+}
+
+// shellQuote quotes s for the shell git runs GIT_SSH_COMMAND with
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// expandHome replaces a leading ~/ in path with the user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[2:])
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSSHIdentity(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "deploy_key")
+	os.WriteFile(key, []byte("key"), 0600)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	os.WriteFile(knownHosts, nil, 0644)
+
+	repo := Repository{URL: "git@github.com:team/app.git", SSHKey: key, KnownHosts: knownHosts, StrictHostKeyChecking: "yes"}
+	if err := CheckSSHIdentity(repo); err != nil {
+		t.Fatalf("Expected valid identity, got %v", err)
+	}
+
+	os.Chmod(key, 0644)
+	if err := CheckSSHIdentity(repo); err == nil {
+		t.Error("Expected error for a key readable by others")
+	}
+	os.Chmod(key, 0600)
+
+	missing := repo
+	missing.KnownHosts = filepath.Join(dir, "missing")
+	if err := CheckSSHIdentity(missing); err == nil {
+		t.Error("Expected error for a missing known_hosts file")
+	}
+
+	invalid := repo
+	invalid.StrictHostKeyChecking = "maybe"
+	if err := CheckSSHIdentity(invalid); err == nil {
+		t.Error("Expected error for an invalid strict_host_key_checking value")
+	}
+}
+
+func TestSSHCommand(t *testing.T) {
+	t.Setenv("GIT_SSH_COMMAND", "")
+
+	// SSH never prompts, even without repository settings
+	if cmd := sshCommand(Repository{URL: "git@github.com:team/app.git"}); cmd != "ssh -o BatchMode=yes" {
+		t.Errorf("Expected batch mode only, got %q", cmd)
+	}
+
+	repo := Repository{
+		URL:                   "git@github.com:team/app.git",
+		SSHKey:                "/keys/app key",
+		KnownHosts:            "/keys/known_hosts",
+		StrictHostKeyChecking: "accept-new",
+	}
+	want := `ssh -i '/keys/app key' -o IdentitiesOnly=yes -o 'UserKnownHostsFile=/keys/known_hosts' -o StrictHostKeyChecking=accept-new -o BatchMode=yes`
+	if cmd := sshCommand(repo); cmd != want {
+		t.Errorf("sshCommand() = %q, want %q", cmd, want)
+	}
+
+	// The key only applies to SSH remotes
+	repo.URL = "https://github.com/team/app.git"
+	env, _ := remoteEnv(repo)
+	for _, v := range env {
+		if strings.HasPrefix(v, "GIT_SSH_COMMAND=ssh") {
+			t.Errorf("HTTPS remote got %s", v)
+		}
+	}
+}
+
+func TestSSHIdentityUsedForClone(t *testing.T) {
+	// A fake ssh records the arguments git passes it, after the shell has
+	// parsed GIT_SSH_COMMAND, then fails the connection
+	argsFile := filepath.Join(t.TempDir(), "args")
+	fakeSSH := writeScript(t, "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\"; done > "+argsFile+"\nexit 255\n")
+	t.Setenv("GIT_SSH_COMMAND", fakeSSH)
+
+	key := filepath.Join(t.TempDir(), "deploy key")
+	os.WriteFile(key, []byte("key"), 0600)
+
+	repo := Repository{
+		URL:    "git@git.example.com:team/app.git",
+		Branch: "main",
+		Path:   filepath.Join(t.TempDir(), "app"),
+		SSHKey: key,
+	}
+	if err := ValidateRepository(repo); err == nil {
+		t.Fatal("Expected clone through the fake ssh to fail")
+	}
+
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("ssh was not run with the repository's command: %v", err)
+	}
+	args := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(args) < 4 || args[0] != "-i" || args[1] != key || args[3] != "IdentitiesOnly=yes" {
+		t.Errorf("Unexpected ssh arguments: %q", args)
+	}
+}
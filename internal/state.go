@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State holds per-repository runtime state that must survive daemon restarts.
+// It is shared between the daemon and CLI commands such as rollback.
+type State struct {
+	Repositories map[string]*RepoState `json:"repositories"`
+}
+
+// RepoState is the persisted state for one deploy path
+type RepoState struct {
+	// PinnedSHA stops the monitor from updating the repository until unpinned
+	PinnedSHA string     `json:"pinned_sha,omitempty"`
+	PinnedAt  *time.Time `json:"pinned_at,omitempty"`
+
+	// ScriptRetry tracks a post-pull script that failed after the commit was deployed
+	ScriptRetry *ScriptRetry `json:"script_retry,omitempty"`
+
+	// InProgress is the deployment currently running; one left behind means the daemon died mid-deploy
+	InProgress *DeployMarker `json:"in_progress,omitempty"`
+	// Interrupted is the last deployment cut short by a shutdown, until the next one finishes
+	Interrupted *DeployMarker `json:"interrupted,omitempty"`
+
+	// Conflict is an update blocked by local changes or diverged history
+	Conflict *ConflictState `json:"conflict,omitempty"`
+
+	// Unverified is an update refused by require_signed, until an update succeeds
+	Unverified *SignatureState `json:"unverified,omitempty"`
+
+	// SkippedSHA is a release left undeployed by a skip directive, until the next deployment
+	SkippedSHA string `json:"skipped_sha,omitempty"`
+
+	// Timeout is the last git command killed for exceeding its timeout, until a fetch succeeds
+	Timeout *TimeoutState `json:"timeout,omitempty"`
+
+	// Failures is the current streak of failed checks, until one succeeds
+	Failures *FailureState `json:"failures,omitempty"`
+}
+
+// DeployMarker identifies a deployment in the state file
+type DeployMarker struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	OldSHA    string    `json:"old_sha"`
+	NewSHA    string    `json:"new_sha"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// TimeoutState records a git command that timed out
+type TimeoutState struct {
+	Command string    `json:"command"`
+	Error   string    `json:"error"`
+	At      time.Time `json:"at"`
+}
+
+// stateMu serialises read-modify-write cycles on the state file within a
+// process; the lock file next to it does so across processes
+var stateMu sync.Mutex
+
+func getStatePath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".spdeploy", "state.json")
+}
+
+// stateKey identifies a repository in the state file. Deploy paths are unique
+// per configuration, while the same URL may be deployed to several paths.
+func stateKey(repo Repository) string {
+	if abs, err := filepath.Abs(repo.Path); err == nil {
+		return abs
+	}
+	return repo.Path
+}
+
+// LoadState reads the state file, returning empty state if it doesn't exist
+func LoadState() *State {
+	state := &State{Repositories: map[string]*RepoState{}}
+
+	data, err := os.ReadFile(getStatePath())
+	if err != nil {
+		return state
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to parse state: %v\n", err)
+		return &State{Repositories: map[string]*RepoState{}}
+	}
+	if state.Repositories == nil {
+		state.Repositories = map[string]*RepoState{}
+	}
+
+	return state
+}
+
+// SaveState writes the state file atomically so readers never see a partial file
+func SaveState(state *State) error {
+	statePath := getStatePath()
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp, statePath); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	return nil
+}
+
+// GetRepoState returns a copy of the stored state for repo
+func GetRepoState(repo Repository) RepoState {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if s, ok := LoadState().Repositories[stateKey(repo)]; ok {
+		return *s
+	}
+	return RepoState{}
+}
+
+// UpdateRepoState loads the state, applies fn to repo's entry and saves it
+func UpdateRepoState(repo Repository, fn func(*RepoState)) error {
+	return updateStateEntry(stateKey(repo), fn)
+}
+
+// updateStateEntry applies fn to the state entry for key and saves it
+func updateStateEntry(key string, fn func(*RepoState)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	unlock, err := lockFile(getStatePath() + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state := LoadState()
+	s, ok := state.Repositories[key]
+	if !ok {
+		s = &RepoState{}
+		state.Repositories[key] = s
+	}
+
+	fn(s)
+
+	return SaveState(state)
+}
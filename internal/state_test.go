@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoState(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	repo := Repository{URL: "git@github.com:test/repo.git", Branch: "main", Path: "/srv/app"}
+
+	if state := GetRepoState(repo); state.PinnedSHA != "" {
+		t.Errorf("Expected empty state, got %+v", state)
+	}
+
+	if err := UpdateRepoState(repo, func(s *RepoState) { s.PinnedSHA = "abc123" }); err != nil {
+		t.Fatalf("UpdateRepoState failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, ".spdeploy", "state.json")); err != nil {
+		t.Fatalf("State file was not written: %v", err)
+	}
+
+	if state := GetRepoState(repo); state.PinnedSHA != "abc123" {
+		t.Errorf("Expected pinned SHA abc123, got %q", state.PinnedSHA)
+	}
+
+	other := Repository{URL: repo.URL, Branch: "main", Path: "/srv/app-staging"}
+	if state := GetRepoState(other); state.PinnedSHA != "" {
+		t.Error("State leaked between deploy paths of the same URL")
+	}
+}
+
+func TestFindRepository(t *testing.T) {
+	cfg := &Config{Repositories: []Repository{
+		{URL: "git@github.com:app/site.git", Branch: "main", Path: "/var/www/prod"},
+		{URL: "git@github.com:app/site.git", Branch: "staging", Path: "/var/www/staging"},
+		{URL: "git@github.com:app/api.git", Branch: "main", Path: "/opt/api"},
+	}}
+
+	if repo, err := FindRepository(cfg, "/var/www/staging"); err != nil || repo.Branch != "staging" {
+		t.Errorf("Expected staging repo by path, got %v (%v)", repo, err)
+	}
+	if repo, err := FindRepository(cfg, "git@github.com:app/api.git"); err != nil || repo.Path != "/opt/api" {
+		t.Errorf("Expected api repo by URL, got %v (%v)", repo, err)
+	}
+	if _, err := FindRepository(cfg, "git@github.com:app/site.git"); err == nil {
+		t.Error("Expected ambiguity error for URL deployed to two paths")
+	}
+	if _, err := FindRepository(cfg, "git@github.com:app/missing.git"); err == nil {
+		t.Error("Expected error for unknown repository")
+	}
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// SubmodulesRecursive checks out every submodule, and theirs, at the commit
+// the superproject records
+const SubmodulesRecursive = "recursive"
+
+// ValidateCheckoutExtras checks repo's submodules and lfs settings
+func ValidateCheckoutExtras(repo Repository) error {
+	if repo.Submodules != "" && repo.Submodules != SubmodulesRecursive {
+		return fmt.Errorf("unknown submodules mode %q (use %s)", repo.Submodules, SubmodulesRecursive)
+	}
+	return nil
+}
+
+// checkLFSInstalled reports an error if repo uses LFS but git-lfs is missing
+func checkLFSInstalled(repo Repository) error {
+	if !repo.LFS {
+		return nil
+	}
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		return fmt.Errorf("lfs is enabled but git-lfs is not installed")
+	}
+	return nil
+}
+
+// updateCheckoutExtras brings the submodules and LFS files of the checkout
+// in dir in line with its HEAD, after a clone or an update. Both download
+// from the network, so they run with repo's credentials, SSH identity and
+// git timeout. LFS files are only smudged here: checkouts and merges leave
+// pointer files, so nothing else fetches from an LFS server.
+func updateCheckoutExtras(repo Repository, dir string) error {
+	if repo.Submodules != "" {
+		if _, err := runGit(dir, "submodule", "sync", "--recursive"); err != nil {
+			return fmt.Errorf("submodule sync failed: %w", err)
+		}
+		if _, err := runRemoteGit(repo, dir, "submodule", "update", "--init", "--recursive"); err != nil {
+			return extrasError(repo, "submodule update", err)
+		}
+	}
+
+	if repo.LFS {
+		if _, err := runGit(dir, "lfs", "install", "--local", "--skip-smudge"); err != nil {
+			return fmt.Errorf("lfs install failed: %w", err)
+		}
+		if _, err := runRemoteGit(repo, dir, "lfs", "pull"); err != nil {
+			return extrasError(repo, "lfs pull", err)
+		}
+		if repo.Submodules != "" {
+			if _, err := runRemoteGit(repo, dir, "submodule", "foreach", "--recursive", "git lfs pull"); err != nil {
+				return extrasError(repo, "lfs pull", err)
+			}
+		}
+	}
+	return nil
+}
+
+// extrasError wraps err from command, remembering a timeout for status
+func extrasError(repo Repository, command string, err error) error {
+	if errors.Is(err, errGitTimeout) {
+		recordGitTimeout(repo, command, err)
+	}
+	return fmt.Errorf("%s failed: %w", command, err)
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestValidateCheckoutExtras(t *testing.T) {
+	if err := ValidateCheckoutExtras(Repository{Submodules: SubmodulesRecursive, LFS: true}); err != nil {
+		t.Errorf("Expected recursive submodules to be valid, got %v", err)
+	}
+	if err := ValidateCheckoutExtras(Repository{Submodules: "some"}); err == nil {
+		t.Error("Expected an unknown submodules mode to be rejected")
+	}
+	if err := ValidateGitBackend(Repository{GitBackend: GitBackendGoGit, LFS: true}, ""); err == nil {
+		t.Error("Expected the go-git backend to reject lfs")
+	}
+}
+
+func TestSubmodules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	// Git refuses local submodule URLs unless the file transport is allowed
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+
+	theme := newTestOrigin(t)
+	origin := newTestOrigin(t)
+	gitT(t, origin, "submodule", "add", "-q", theme, "theme")
+	gitT(t, origin, "commit", "-q", "-m", "Add theme")
+
+	repo := Repository{
+		URL:        origin,
+		Branch:     "main",
+		Path:       filepath.Join(t.TempDir(), "app"),
+		Submodules: SubmodulesRecursive,
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	themeIndex := filepath.Join(repo.Path, "theme", "index.html")
+	if content, _ := os.ReadFile(themeIndex); string(content) != "v1" {
+		t.Fatalf("Expected the submodule to be checked out on clone, got %q", content)
+	}
+
+	// Bump the submodule upstream
+	commitFile(t, theme, "index.html", "v2")
+	gitT(t, origin, "submodule", "update", "-q", "--remote", "theme")
+	gitT(t, origin, "commit", "-q", "-am", "Bump theme")
+
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.checkRepository(repo)
+
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path, Limit: 1})
+	if len(history) != 1 || history[0].Status != DeployStatusSuccess {
+		t.Fatalf("Expected a successful deployment, got %+v", history)
+	}
+	if content, _ := os.ReadFile(themeIndex); string(content) != "v2" {
+		t.Errorf("Expected the submodule to be updated, got %q", content)
+	}
+}
+
+func TestLFS(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake git-lfs is a shell script")
+	}
+	t.Setenv("HOME", t.TempDir())
+
+	// A stand-in git-lfs that records how it was called
+	bin := t.TempDir()
+	calls := filepath.Join(bin, "calls")
+	script := "#!/bin/sh\necho \"$*\" >> " + calls + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "git-lfs"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	origin := newTestOrigin(t)
+	repo := Repository{URL: origin, Branch: "main", Path: filepath.Join(t.TempDir(), "app"), LFS: true}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+
+	commitFile(t, origin, "index.html", "v2")
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+	monitor.checkRepository(repo)
+
+	data, _ := os.ReadFile(calls)
+	got := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{"install --local --skip-smudge", "pull", "install --local --skip-smudge", "pull"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("git-lfs calls = %q, want %q on clone and update", got, want)
+	}
+}
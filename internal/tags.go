@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/mod/semver"
+	"spdeploy/internal/logger"
+)
+
+// tagVersion returns the semantic version in a tag name in the canonical
+// form the semver package expects. Anything before the first digit is
+// ignored, so v1.2.3 and release-1.2.3 both parse.
+func tagVersion(tag string) (string, bool) {
+	i := strings.IndexAny(tag, "0123456789")
+	if i < 0 {
+		return "", false
+	}
+	v := "v" + tag[i:]
+	return v, semver.IsValid(v)
+}
+
+// ValidateTagPattern checks repo's tag pattern
+func ValidateTagPattern(repo Repository) error {
+	if repo.Tag == "" {
+		return nil
+	}
+	if _, err := path.Match(repo.Tag, ""); err != nil {
+		return fmt.Errorf("invalid tag pattern %q", repo.Tag)
+	}
+	return nil
+}
+
+// latestTag returns the highest semantic version among tags, considering
+// only those matching repo's tag pattern. Pre-releases are skipped unless
+// the repository opts into them.
+func latestTag(repo Repository, tags []string) (string, bool) {
+	var best, bestVersion string
+	for _, tag := range tags {
+		if ok, _ := path.Match(repo.Tag, tag); !ok {
+			continue
+		}
+		v, ok := tagVersion(tag)
+		if !ok || (semver.Prerelease(v) != "" && !repo.Prerelease) {
+			continue
+		}
+		if best == "" || semver.Compare(v, bestVersion) > 0 {
+			best, bestVersion = tag, v
+		}
+	}
+	return best, best != ""
+}
+
+// tagAt returns the highest matching tag pointing at sha, or "" when repo
+// doesn't track tags
+func tagAt(repo Repository, dir, sha string) string {
+	if repo.Tag == "" {
+		return ""
+	}
+	output, err := runGit(dir, "tag", "--points-at", sha)
+	if err != nil {
+		return ""
+	}
+	tag, _ := latestTag(repo, strings.Fields(output))
+	return tag
+}
+
+// fetchArgs returns the git fetch arguments for repo. Tag-tracking
+// repositories fetch every tag, replacing ones that were moved and dropping
+// ones deleted upstream so a withdrawn release is never deployed. Otherwise
+// only the deployed branch is fetched.
+func fetchArgs(repo Repository) []string {
+	if repo.Tag != "" {
+		return []string{"fetch", "--prune", "--prune-tags", "--tags", "--force", "origin"}
+	}
+	return []string{"fetch", "origin", "+refs/heads/" + repo.Branch + ":refs/remotes/origin/" + repo.Branch}
+}
+
+// resolveTarget returns the ref and commit repo should be deployed at in
+// dir: the highest matching tag in tag mode, otherwise the branch head.
+// The ref is "" when no tag matches.
+func resolveTarget(repo Repository, dir string) (ref, sha string, err error) {
+	if repo.Tag == "" {
+		ref = "origin/" + repo.Branch
+		sha, err = runGit(dir, "rev-parse", ref)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to resolve branch %s: %w", repo.Branch, err)
+		}
+		return ref, sha, nil
+	}
+
+	output, err := runGit(dir, "tag", "--list")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list tags: %w", err)
+	}
+	tag, ok := latestTag(repo, strings.Fields(output))
+	if !ok {
+		return "", "", nil
+	}
+	sha, err = runGit(dir, "rev-parse", "refs/tags/"+tag+"^{commit}")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve tag %s: %w", tag, err)
+	}
+	return tag, sha, nil
+}
+
+// checkTag deploys the highest matching tag into repo.Path by checking it
+// out detached. The caller has already fetched.
+func (m *MonitorV2) checkTag(repo Repository, repoLogger *logger.RepoLogger) error {
+	tag, newSHA, err := resolveTarget(repo, repo.Path)
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+	if tag == "" {
+		logWarn(repoLogger, repo, "No tag matches the pattern", zap.String("tag", repo.Tag))
+		return nil
+	}
+
+	oldSHA, err := runGit(repo.Path, "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	if oldSHA == newSHA {
+		clearConflict(repo)
+		// Already on the tag, but a failed script for it may be due a retry
+		if repo.PostPullScript != "" {
+			m.retryPendingScript(repo, repoLogger)
+		}
+		return nil
+	}
+
+	target := "refs/tags/" + tag
+	if err := deepenTo(repo, repo.Path, oldSHA, target, repoLogger); err != nil {
+		return err
+	}
+	conflict, err := detectConflict(repo, target)
+	if err != nil {
+		return fmt.Errorf("failed to inspect working copy: %w", err)
+	}
+	if err := conflictError(repo, conflict); err != nil {
+		m.reportConflict(repo, oldSHA, newSHA, tag, err, repoLogger)
+		return nil
+	}
+
+	if err := verifySignatures(repo, repo.Path, oldSHA, newSHA); err != nil {
+		if errors.Is(err, errUnverified) {
+			m.reportUnverified(repo, oldSHA, newSHA, tag, err, repoLogger)
+			return nil
+		}
+		return fmt.Errorf("failed to verify signatures: %w", err)
+	}
+
+	logInfo(repoLogger, repo, "New tag detected",
+		zap.String("tag", tag),
+		zap.String("old_sha", oldSHA),
+		zap.String("new_sha", newSHA))
+
+	paths, relevant, err := watchedChanges(repo, oldSHA, newSHA, repoLogger)
+	if err != nil {
+		return fmt.Errorf("failed to diff changes: %w", err)
+	}
+	directive, err := commitDirective(repo, oldSHA, newSHA, repoLogger)
+	if err != nil {
+		return err
+	}
+	switch directive {
+	case DirectiveSkip:
+		relevant = false
+	case DirectiveForceScript:
+		relevant = true
+	}
+
+	deploy := newDeployment(repo, DeployKindDeploy)
+	deploy.Tag = tag
+	deploy.OldSHA = oldSHA
+	deploy.NewSHA = newSHA
+	deploy.CommitCount = countCommits(repo, repo.Path, oldSHA, newSHA)
+	deploy.Paths = paths
+	deploy.Directive = directive
+	m.beginDeployment(repo, deploy)
+	defer m.recordDeployment(deploy)
+
+	if relevant {
+		if err := m.runHooks(repo, HookPreDeploy, deploy, repoLogger); err != nil {
+			logWarn(repoLogger, repo, "Deployment vetoed by pre_deploy hook", zap.Error(err))
+			deploy.veto(err)
+			return nil
+		}
+	}
+
+	output, err := m.updateWorkingTree(repo, deploy, target, conflict, func() (string, error) {
+		return runGit(repo.Path, "checkout", "--detach", target)
+	}, repoLogger)
+	deploy.PullOutput = output
+	if err != nil {
+		logError(repoLogger, repo, "Failed to check out tag", zap.String("tag", tag), zap.Error(err))
+		m.finishDeployment(repo, deploy, fmt.Errorf("checkout of %s failed: %w", tag, err), repoLogger)
+		return nil
+	}
+	logInfo(repoLogger, repo, "Checked out tag", zap.String("tag", tag))
+	if err := updateCheckoutExtras(repo, repo.Path); err != nil {
+		logError(repoLogger, repo, "Failed to update submodules or LFS files", zap.Error(err))
+		m.finishDeployment(repo, deploy, err, repoLogger)
+		return nil
+	}
+
+	if !relevant {
+		deploy.skip()
+		return nil
+	}
+
+	if repo.PostPullScript != "" {
+		if directive == DirectiveNoScript {
+			logInfo(repoLogger, repo, "Post-pull script skipped by commit message directive")
+		} else {
+			err = m.executePostPullScript(repo, deploy, repoLogger)
+			deploy.setScriptResult(err)
+		}
+	}
+	m.finishDeployment(repo, deploy, err, repoLogger)
+	return nil
+}
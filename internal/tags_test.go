@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLatestTag(t *testing.T) {
+	tags := []string{"v1.2.0", "v1.10.0", "v1.9.3", "v2.0.0-rc.1", "v2.0.0-beta", "latest", "release-3.0.0", "v1.10"}
+
+	tests := []struct {
+		pattern    string
+		prerelease bool
+		want       string
+	}{
+		{"v*", false, "v1.10.0"},
+		{"v*", true, "v2.0.0-rc.1"},
+		{"v1.9.*", false, "v1.9.3"},
+		{"release-*", false, "release-3.0.0"},
+		{"*", false, "release-3.0.0"},
+		{"deploy-*", false, ""},
+	}
+	for _, tt := range tests {
+		got, _ := latestTag(Repository{Tag: tt.pattern, Prerelease: tt.prerelease}, tags)
+		if got != tt.want {
+			t.Errorf("latestTag(%q, prerelease=%v) = %q, want %q", tt.pattern, tt.prerelease, got, tt.want)
+		}
+	}
+
+	if err := ValidateTagPattern(Repository{Tag: "v["}); err == nil {
+		t.Error("Expected error for an invalid pattern")
+	}
+}
+
+func TestTagTracking(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	gitT(t, origin, "tag", "v1.0.0")
+	commitFile(t, origin, "deploy.sh", "#!/bin/sh\necho \"$SPDEPLOY_TAG\" > deployed-tag\n")
+	v11 := gitT(t, origin, "rev-parse", "HEAD")
+	gitT(t, origin, "tag", "-a", "v1.1.0", "-m", "Release 1.1.0")
+	commitFile(t, origin, "index.html", "unreleased")
+
+	repo := Repository{
+		URL:            origin,
+		Branch:         "main",
+		Path:           filepath.Join(t.TempDir(), "app"),
+		Tag:            "v*",
+		PostPullScript: "deploy.sh",
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	monitor.checkRepository(repo)
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != v11 {
+		t.Fatalf("Expected HEAD at v1.1.0 (%s), got %s", v11, head)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo.Path, "deployed-tag")); string(data) != "v1.1.0\n" {
+		t.Errorf("Expected SPDEPLOY_TAG v1.1.0, got %q", data)
+	}
+
+	// Pre-releases are ignored unless opted in
+	commitFile(t, origin, "index.html", "rc")
+	rc := gitT(t, origin, "rev-parse", "HEAD")
+	gitT(t, origin, "tag", "v2.0.0-rc.1")
+	monitor.checkRepository(repo)
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != v11 {
+		t.Errorf("Pre-release was deployed without opting in")
+	}
+
+	repo.Prerelease = true
+	monitor.checkRepository(repo)
+	if head := gitT(t, repo.Path, "rev-parse", "HEAD"); head != rc {
+		t.Errorf("Expected HEAD at v2.0.0-rc.1 with pre-releases enabled, got %s", head)
+	}
+
+	history, _ := LoadHistory(HistoryFilter{Repo: repo.Path})
+	if len(history) != 2 || history[0].Tag != "v2.0.0-rc.1" || history[1].Tag != "v1.1.0" {
+		t.Errorf("Expected two tag deployments in history, got %+v", history)
+	}
+}
+
+func TestTagTrackingRelease(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	origin := newTestOrigin(t)
+	v1 := gitT(t, origin, "rev-parse", "HEAD")
+	gitT(t, origin, "tag", "v1.0.0")
+	commitFile(t, origin, "index.html", "unreleased")
+
+	repo := Repository{
+		URL:      origin,
+		Branch:   "main",
+		Path:     filepath.Join(t.TempDir(), "site"),
+		Strategy: StrategyRelease,
+		Tag:      "v*",
+	}
+	if err := ValidateRepository(repo); err != nil {
+		t.Fatalf("ValidateRepository failed: %v", err)
+	}
+	monitor := NewMonitorV2(&Config{CheckInterval: 60, Repositories: []Repository{repo}})
+
+	monitor.checkRepository(repo)
+	if got := currentReleaseSHA(repo); got != v1 {
+		t.Fatalf("Expected current release at v1.0.0 (%s), got %q", v1, got)
+	}
+
+	v2 := commitFile(t, origin, "index.html", "v2")
+	gitT(t, origin, "tag", "v2.0.0")
+	monitor.checkRepository(repo)
+	if got := currentReleaseSHA(repo); got != v2 {
+		t.Errorf("Expected current release at v2.0.0 (%s), got %q", v2, got)
+	}
+}
@@ -0,0 +1,388 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+	"spdeploy/internal/logger"
+)
+
+// maxWebhookBody caps the size of a webhook payload we are willing to read
+const maxWebhookBody = 5 << 20
+
+var (
+	errUnknownProvider   = errors.New("unrecognised webhook provider")
+	errInvalidSignature  = errors.New("invalid webhook signature")
+	errNotPushEvent      = errors.New("not a push event")
+	errMissingRepository = errors.New("payload does not identify a repository")
+)
+
+// pushEvent is the provider-independent view of a push webhook
+type pushEvent struct {
+	Provider string
+	// Branch or Tag is set, depending on the pushed ref
+	Branch string
+	Tag    string
+	URLs   []string
+}
+
+// webhookPayload covers the fields we need from GitHub, Gitea and GitLab push payloads
+type webhookPayload struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL   string `json:"clone_url"`
+		SSHURL     string `json:"ssh_url"`
+		HTMLURL    string `json:"html_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+		GitHTTPURL string `json:"git_http_url"`
+	} `json:"repository"`
+	Project struct {
+		GitSSHURL  string `json:"git_ssh_url"`
+		GitHTTPURL string `json:"git_http_url"`
+		WebURL     string `json:"web_url"`
+	} `json:"project"`
+}
+
+// bitbucketPayload covers Bitbucket Cloud (repo:push) and Bitbucket Server (repo:refs_changed)
+type bitbucketPayload struct {
+	Repository struct {
+		FullName string `json:"full_name"`
+		Links    struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+			Clone []struct {
+				Href string `json:"href"`
+			} `json:"clone"`
+		} `json:"links"`
+	} `json:"repository"`
+	Push struct {
+		Changes []struct {
+			New *struct {
+				Type string `json:"type"`
+				Name string `json:"name"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+	Changes []struct {
+		Ref struct {
+			ID        string `json:"id"`
+			DisplayID string `json:"displayId"`
+			Type      string `json:"type"`
+		} `json:"ref"`
+	} `json:"changes"`
+}
+
+// ServeWebhooks starts the webhook listener and blocks until it stops
+func (m *MonitorV2) ServeWebhooks() error {
+	hook := m.currentConfig().Webhook
+	path := hook.Path
+	if path == "" {
+		path = "/webhook"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, m.webhookHandler())
+
+	logger.Info("Starting webhook listener",
+		zap.String("listen", hook.Listen),
+		zap.String("path", path))
+
+	server := &http.Server{Addr: hook.Listen, Handler: mux}
+	m.shutdownMu.Lock()
+	if m.shuttingDown {
+		m.shutdownMu.Unlock()
+		return nil
+	}
+	m.webhookServer = server
+	m.shutdownMu.Unlock()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// webhookHandler returns the HTTP handler that turns push webhooks into repository checks
+func (m *MonitorV2) webhookHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		hook := m.currentConfig().Webhook
+		if hook == nil || hook.Secret == "" {
+			// Webhooks were removed from the config since the listener
+			// started, or never had a secret to verify requests with
+			http.NotFound(w, r)
+			return
+		}
+
+		event, err := parseWebhook(r.Header, body, hook.Secret)
+		switch {
+		case errors.Is(err, errInvalidSignature):
+			logger.Warn("Rejected webhook with invalid signature",
+				zap.String("remote", r.RemoteAddr))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case errors.Is(err, errNotPushEvent):
+			// Pings and other events are acknowledged but ignored
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		matched := m.matchRepositories(event)
+		if len(matched) == 0 {
+			logger.Info("Webhook did not match any monitored repository",
+				zap.String("provider", event.Provider),
+				zap.String("branch", event.Branch),
+				zap.String("tag", event.Tag),
+				zap.Strings("urls", event.URLs))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		for _, repo := range matched {
+			logger.Info("Webhook triggered repository check",
+				zap.String("provider", event.Provider),
+				zap.String("repo", repo.URL),
+				zap.String("branch", repo.Branch),
+				zap.String("path", repo.Path))
+			if usesMirror(repo) {
+				expireMirror(repo.URL)
+			}
+			if !m.triggerCheck(repo) {
+				logger.Debug("Check already queued for repository",
+					zap.String("path", repo.Path))
+			}
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "triggered %d repositories\n", len(matched))
+	})
+}
+
+// matchRepositories returns every configured repository tracking the pushed
+// URL and branch, or a tag pattern the pushed tag matches
+func (m *MonitorV2) matchRepositories(event *pushEvent) []Repository {
+	keys := make(map[string]bool)
+	for _, u := range event.URLs {
+		if u != "" {
+			keys[repoKey(u)] = true
+		}
+	}
+
+	var matched []Repository
+	for _, repo := range m.currentConfig().Repositories {
+		if !keys[repoKey(repo.URL)] {
+			continue
+		}
+		if repo.Tag != "" {
+			// Tag-tracking repositories react to matching tags, not branch pushes
+			if ok, _ := path.Match(repo.Tag, event.Tag); ok && event.Tag != "" {
+				matched = append(matched, repo)
+			}
+		} else if event.Branch != "" && repo.Branch == event.Branch {
+			matched = append(matched, repo)
+		}
+	}
+	return matched
+}
+
+// parseWebhook identifies the provider, verifies the request and extracts the push details
+func parseWebhook(header http.Header, body []byte, secret string) (*pushEvent, error) {
+	// An empty key would let anyone sign a request, so never accept one
+	if secret == "" {
+		return nil, errInvalidSignature
+	}
+
+	switch {
+	case header.Get("X-Gitea-Event") != "":
+		if !validHMAC(body, secret, header.Get("X-Gitea-Signature")) {
+			return nil, errInvalidSignature
+		}
+		if header.Get("X-Gitea-Event") != "push" {
+			return nil, errNotPushEvent
+		}
+		return parseGitPayload("gitea", body)
+
+	case header.Get("X-GitHub-Event") != "":
+		if !validHMAC(body, secret, strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")) {
+			return nil, errInvalidSignature
+		}
+		if header.Get("X-GitHub-Event") != "push" {
+			return nil, errNotPushEvent
+		}
+		return parseGitPayload("github", body)
+
+	case header.Get("X-Gitlab-Event") != "":
+		token := header.Get("X-Gitlab-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return nil, errInvalidSignature
+		}
+		if header.Get("X-Gitlab-Event") != "Push Hook" {
+			return nil, errNotPushEvent
+		}
+		return parseGitPayload("gitlab", body)
+
+	case header.Get("X-Event-Key") != "":
+		if !validHMAC(body, secret, strings.TrimPrefix(header.Get("X-Hub-Signature"), "sha256=")) {
+			return nil, errInvalidSignature
+		}
+		key := header.Get("X-Event-Key")
+		if key != "repo:push" && key != "repo:refs_changed" {
+			return nil, errNotPushEvent
+		}
+		return parseBitbucketPayload(body)
+	}
+
+	return nil, errUnknownProvider
+}
+
+// parseGitPayload handles the GitHub-style payloads shared by GitHub, Gitea and GitLab
+func parseGitPayload(provider string, body []byte) (*pushEvent, error) {
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	event := &pushEvent{Provider: provider}
+	switch {
+	case strings.HasPrefix(payload.Ref, "refs/heads/"):
+		event.Branch = strings.TrimPrefix(payload.Ref, "refs/heads/")
+	case strings.HasPrefix(payload.Ref, "refs/tags/"):
+		event.Tag = strings.TrimPrefix(payload.Ref, "refs/tags/")
+	default:
+		return nil, errNotPushEvent
+	}
+	for _, u := range []string{
+		payload.Repository.CloneURL,
+		payload.Repository.SSHURL,
+		payload.Repository.HTMLURL,
+		payload.Repository.GitSSHURL,
+		payload.Repository.GitHTTPURL,
+		payload.Project.GitSSHURL,
+		payload.Project.GitHTTPURL,
+		payload.Project.WebURL,
+	} {
+		if u != "" {
+			event.URLs = append(event.URLs, u)
+		}
+	}
+
+	if len(event.URLs) == 0 {
+		return nil, errMissingRepository
+	}
+	return event, nil
+}
+
+// parseBitbucketPayload handles Bitbucket Cloud and Bitbucket Server push payloads
+func parseBitbucketPayload(body []byte) (*pushEvent, error) {
+	var payload bitbucketPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	event := &pushEvent{Provider: "bitbucket"}
+
+	for _, change := range payload.Push.Changes {
+		if change.New != nil && change.New.Type == "branch" {
+			event.Branch = change.New.Name
+			break
+		}
+		if change.New != nil && change.New.Type == "tag" {
+			event.Tag = change.New.Name
+			break
+		}
+	}
+	if event.Branch == "" && event.Tag == "" {
+		for _, change := range payload.Changes {
+			if change.Ref.Type == "BRANCH" || strings.HasPrefix(change.Ref.ID, "refs/heads/") {
+				event.Branch = change.Ref.DisplayID
+				break
+			}
+			if change.Ref.Type == "TAG" || strings.HasPrefix(change.Ref.ID, "refs/tags/") {
+				event.Tag = change.Ref.DisplayID
+				break
+			}
+		}
+	}
+	if event.Branch == "" && event.Tag == "" {
+		return nil, errNotPushEvent
+	}
+
+	if payload.Repository.Links.HTML.Href != "" {
+		event.URLs = append(event.URLs, payload.Repository.Links.HTML.Href)
+	} else if payload.Repository.FullName != "" {
+		event.URLs = append(event.URLs, "https://bitbucket.org/"+payload.Repository.FullName)
+	}
+	for _, link := range payload.Repository.Links.Clone {
+		event.URLs = append(event.URLs, link.Href)
+	}
+
+	if len(event.URLs) == 0 {
+		return nil, errMissingRepository
+	}
+	return event, nil
+}
+
+// validHMAC checks a hex-encoded HMAC-SHA256 signature of body
+func validHMAC(body []byte, secret, signature string) bool {
+	if signature == "" {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// repoKey reduces a repository URL to a comparable host/path form so that
+// SSH, HTTPS and web URLs for the same repository compare equal
+func repoKey(url string) string {
+	key := strings.TrimSpace(url)
+
+	if idx := strings.Index(key, "://"); idx >= 0 {
+		key = key[idx+3:]
+		// Drop any credentials
+		if at := strings.LastIndex(key, "@"); at >= 0 && at < strings.Index(key+"/", "/") {
+			key = key[at+1:]
+		}
+		// Drop any port
+		if slash := strings.Index(key, "/"); slash >= 0 {
+			if colon := strings.Index(key[:slash], ":"); colon >= 0 {
+				key = key[:colon] + key[slash:]
+			}
+		}
+	} else if at := strings.Index(key, "@"); at >= 0 {
+		// scp-like syntax: user@host:path
+		key = strings.Replace(key[at+1:], ":", "/", 1)
+	}
+
+	key = strings.TrimSuffix(key, "/")
+	key = strings.TrimSuffix(key, ".git")
+	return strings.ToLower(key)
+}